@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/BatikanHyt/netbench/pkg/protocols"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// configPath returns the value of --config in args, which cobra has not
+// parsed yet.
+func configPath(args []string) string {
+	var path string
+	flags := pflag.NewFlagSet("config", pflag.ContinueOnError)
+	flags.ParseErrorsWhitelist.UnknownFlags = true
+	flags.Usage = func() {}
+	flags.StringVar(&path, "config", "", "")
+	flags.BoolP("help", "h", false, "")
+	flags.Parse(args)
+	return path
+}
+
+// initConfig loads the config file into the runner. The protocol block is
+// also decoded into the protocol of the matching subcommand, on top of its
+// flag defaults. The process exits listing the problems of an invalid
+// config.
+func initConfig(path string) {
+	data, err := protocols.ReadConfig(path)
+	if err == nil {
+		err = json.Unmarshal(data, &runner)
+	}
+	if err != nil {
+		fmt.Printf("Invalid config %s:\n%s\n", path, err)
+		os.Exit(1)
+	}
+	var blocks map[string]json.RawMessage
+	json.Unmarshal(data, &blocks)
+	for name, protocol := range protocolInstances {
+		if block, ok := blocks[name]; ok {
+			json.Unmarshal(block, protocol)
+		}
+	}
+}
+
+// envName returns the environment variable of a flag, NETBENCH_<FLAG> for
+// the flags of every command and NETBENCH_<COMMAND>_<FLAG> for the others,
+// e.g. NETBENCH_CONCURENCY or NETBENCH_HTTP_METHOD.
+func envName(cmd *cobra.Command, flag *pflag.Flag) string {
+	name := flag.Name
+	if cmd.Root().PersistentFlags().Lookup(flag.Name) == nil {
+		name = cmd.Name() + "_" + name
+	}
+	return "NETBENCH_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+}
+
+// applyEnv sets the flags missing from the command line from their
+// environment variable, so the environment overrides the config file and
+// the command line overrides the environment.
+func applyEnv(cmd *cobra.Command) error {
+	var err error
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if err != nil || flag.Changed || flag.Name == "config" || flag.Name == "help" || flag.Name == "version" {
+			return
+		}
+		name := envName(cmd, flag)
+		if value, ok := os.LookupEnv(name); ok {
+			if setErr := cmd.Flags().Set(flag.Name, value); setErr != nil {
+				err = fmt.Errorf("Invalid %s=%s: %s", name, value, setErr)
+			}
+		}
+	})
+	return err
+}
+
+// printConfig prints the effective config of the run as JSON.
+func printConfig() {
+	data, err := json.MarshalIndent(runner.Config(), "", "    ")
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		return
+	}
+	fmt.Println(string(data))
+}
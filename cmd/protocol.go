@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/BatikanHyt/netbench/pkg/protocols"
+	"github.com/spf13/cobra"
+)
+
+// protocolInstances are the protocols the subcommands bind their flags to,
+// by protocol name.
+var protocolInstances = make(map[string]protocols.BaseProtocol)
+
+// addProtocolCmds adds a subcommand for every registered protocol. It runs
+// from Execute so protocols registered by packages imported next to cmd are
+// picked up too.
+func addProtocolCmds() {
+	for _, name := range protocols.Registered() {
+		def, _ := protocols.Lookup(name)
+		rootCmd.AddCommand(newProtocolCmd(def))
+	}
+}
+
+func newProtocolCmd(def protocols.Definition) *cobra.Command {
+	protocol := def.New()
+	protocolInstances[def.Name] = protocol
+	cmd := &cobra.Command{
+		Use:   def.Use,
+		Short: def.Short,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if len(runner.Scenarios) > 0 {
+				return fmt.Errorf("Config %s has scenarios, run it without the %s subcommand", rootCmdArgs.ConfigFile, def.Name)
+			}
+			if runner.Protocol != nil && runner.ProtocolName != def.Name {
+				return fmt.Errorf("Config %s benchmarks %s, not %s", rootCmdArgs.ConfigFile, runner.ProtocolName, def.Name)
+			}
+			if def.Args == nil {
+				return nil
+			}
+			return def.Args(protocol, args)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			runner.SetProtocol(def.Name, protocol)
+			if rootCmdArgs.PrintConfig {
+				printConfig()
+				return
+			}
+			runner.Run()
+		},
+	}
+	if def.BindFlags != nil {
+		def.BindFlags(cmd.Flags(), protocol)
+	}
+	return cmd
+}
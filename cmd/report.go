@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var reportCmd = &cobra.Command{
+	Use:   "report [raw log]",
+	Short: "Recompute statistics and reports from a raw log",
+	Long:  "Reads a raw log written with --raw-log and prints the statistics, --output writes them in any result format",
+	Args:  cobra.ExactArgs(1),
+	Run:   runReportCmd,
+}
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+}
+
+func runReportCmd(cmd *cobra.Command, args []string) {
+	if err := runner.Replay(args[0]); err != nil {
+		fmt.Printf("Error: %s\n", err)
+	}
+}
@@ -1,18 +1,21 @@
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"time"
 
+	"github.com/BatikanHyt/netbench/pkg/collector"
+	"github.com/BatikanHyt/netbench/pkg/helpers"
 	"github.com/BatikanHyt/netbench/pkg/protocols"
+	"github.com/BatikanHyt/netbench/pkg/report"
 	"github.com/spf13/cobra"
 )
 
 var rootCmdArgs struct {
-	ConfigFile string
+	ConfigFile  string
+	Stages      []string
+	PrintConfig bool
 }
 var runner = &protocols.Runner{}
 
@@ -27,13 +30,27 @@ var rootCmd = &cobra.Command{
 			fmt.Println("Please select config file")
 			return
 		}
-		initConfig()
-
+		if runner.Protocol == nil && len(runner.Scenarios) == 0 {
+			fmt.Printf("Config %s has no protocol, add one of %v or use a subcommand\n", rootCmdArgs.ConfigFile, protocols.Registered())
+			os.Exit(1)
+		}
+		if rootCmdArgs.PrintConfig {
+			printConfig()
+			return
+		}
 		runner.Run()
 	},
 }
 
+// Execute runs the command line. Settings are layered, from lowest to
+// highest priority: flag defaults, the config file, NETBENCH_* environment
+// variables and the flags given on the command line. The config file is
+// therefore loaded before cobra parses the flags.
 func Execute() {
+	addProtocolCmds()
+	if path := configPath(os.Args[1:]); path != "" {
+		initConfig(path)
+	}
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -41,33 +58,107 @@ func Execute() {
 }
 
 func init() {
-	rootCmd.PersistentFlags().StringVar(&rootCmdArgs.ConfigFile, "config", "", "Json format config file to load settings")
-	rootCmd.PersistentFlags().IntVarP(&runner.Concurency, "concurency", "c", 1, "Number of concurent connection size")
+	rootCmd.PersistentFlags().StringVar(&rootCmdArgs.ConfigFile, "config", "", fmt.Sprintf("Config file to load settings, in one of the formats %v", protocols.ConfigFormats))
+	rootCmd.PersistentFlags().IntVarP(&runner.Concurency, "concurency", "c", 1, "Number of concurent connection size, caps in-flight requests when rate is set")
 	rootCmd.PersistentFlags().IntVarP(&runner.TotalRequest, "treq", "n", 1, "Number of total request to send")
 	rootCmd.PersistentFlags().StringVarP(&runner.Duration, "duration", "d", "0s", "total duration 1s, 1m, 500ms etc")
+	rootCmd.PersistentFlags().Float64VarP(&runner.Rate, "rate", "r", 0, "Open-loop arrival rate in requests/sec, 0 keeps the closed-loop mode")
+	rootCmd.PersistentFlags().StringSliceVar(&rootCmdArgs.Stages, "stages", nil, "Load stages in duration:target format, e.g. 30s:200,5m:200,30s:0")
+	rootCmd.PersistentFlags().StringVar(&runner.StageTarget, "stage-target", protocols.StageTargetWorkers, "What stage targets control (workers, rate)")
+	rootCmd.PersistentFlags().StringVar(&runner.StageMode, "stage-mode", protocols.StageModeRamp, "How stages reach their target (ramp, step)")
+	rootCmd.PersistentFlags().StringVarP(&runner.OutputFormat, "output", "o", "", fmt.Sprintf("Write the results to a file in the given format %v", report.Formats()))
+	rootCmd.PersistentFlags().StringVar(&runner.OutputFile, "output-file", "", "Result file path, defaults to netbench-result.<ext>")
+	rootCmd.PersistentFlags().StringVar(&runner.Interval, "interval", collector.DefaultInterval.String(), "Length of a timeline interval 1s, 10s, 500ms etc")
+	rootCmd.PersistentFlags().StringVar(&runner.RawLog, "raw-log", "", "Append every request to this file for offline analysis with netbench report")
+	rootCmd.PersistentFlags().StringVar(&runner.RawLogFormat, "raw-format", collector.RawLogNdjson, fmt.Sprintf("Raw log format %v", collector.ValidRawLogFormats))
+	rootCmd.PersistentFlags().IntVar(&runner.Precision, "precision", collector.DefaultPrecision, "Significant digits of the latency histograms (1-5)")
+	rootCmd.PersistentFlags().StringVar(&runner.Timeout, "timeout", "0s", "Deadline of every request 1s, 500ms etc, 0s for none")
+	rootCmd.PersistentFlags().BoolVar(&rootCmdArgs.PrintConfig, "print-config", false, "Print the effective config after merging the config file, environment and flags, then exit")
+	rootCmd.PersistentFlags().StringVar(&runner.DrainTimeout, "drain-timeout", protocols.DefaultDrainTimeout.String(), "Time in-flight requests get to finish after an interrupt")
 }
 
-func initConfig() {
-	jsonFile, err := os.Open(rootCmdArgs.ConfigFile)
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
-	jsonData, _ := ioutil.ReadAll(jsonFile)
-	json.Unmarshal([]byte(jsonData), &runner)
+// flagSettings are the runner flags and the config keys they set.
+var flagSettings = map[string]string{
+	"concurency":    "concurency",
+	"treq":          "totalRequest",
+	"duration":      "duration",
+	"rate":          "rate",
+	"stages":        "stages",
+	"stage-target":  "stageTarget",
+	"stage-mode":    "stageMode",
+	"interval":      "interval",
+	"raw-format":    "rawLogFormat",
+	"precision":     "precision",
+	"timeout":       "timeout",
+	"drain-timeout": "drainTimeout",
 }
 
 func validateRootArgs(cmd *cobra.Command, args []string) error {
-	if cmd.Flags().Changed("duration") && cmd.Flags().Changed("treq") {
+	cliDuration, cliTreq := cmd.Flags().Changed("duration"), cmd.Flags().Changed("treq")
+	if err := applyEnv(cmd); err != nil {
+		return err
+	}
+	setDuration, setTreq := cmd.Flags().Changed("duration"), cmd.Flags().Changed("treq")
+	if setDuration && setTreq && cliDuration == cliTreq {
 		return fmt.Errorf("Cant set both duration(d) and total request(n)")
 	}
+	// the duration wins over the total request unless the total request
+	// comes from a higher layer, e.g. -n over the duration of the config file
+	resetDuration := setTreq && (!setDuration || cliTreq)
+	if resetDuration {
+		runner.Duration = "0s"
+	}
+	if runner.Precision < 1 || runner.Precision > 5 {
+		return fmt.Errorf("Precision must be between 1 and 5")
+	}
+	if len(rootCmdArgs.Stages) > 0 {
+		stages, err := protocols.ParseStages(rootCmdArgs.Stages)
+		if err != nil {
+			return err
+		}
+		runner.Stages = stages
+	}
+	if err := runner.ValidateStages(); err != nil {
+		return err
+	}
+	if interval, err := time.ParseDuration(runner.Interval); err != nil || interval <= 0 {
+		return fmt.Errorf("Invalid interval %s", runner.Interval)
+	}
+	if !helpers.Contains(collector.ValidRawLogFormats, runner.RawLogFormat) {
+		return fmt.Errorf("Invalid raw log format %s. Valid formats: %v", runner.RawLogFormat, collector.ValidRawLogFormats)
+	}
+	if runner.OutputFormat != "" {
+		if _, err := report.NewWriter(runner.OutputFormat); err != nil {
+			return err
+		}
+	}
+	if timeout, err := time.ParseDuration(runner.Timeout); err != nil || timeout < 0 {
+		return fmt.Errorf("Invalid timeout %s", runner.Timeout)
+	}
+	if timeout, err := time.ParseDuration(runner.DrainTimeout); err != nil || timeout < 0 {
+		return fmt.Errorf("Invalid drain timeout %s", runner.DrainTimeout)
+	}
+	if runner.Rate < 0 {
+		return fmt.Errorf("Rate cannot be negative")
+	}
 	_, isValid := time.ParseDuration(runner.Duration)
 	if isValid != nil {
 		return fmt.Errorf("Error : %e", isValid)
 	}
-	if rootCmdArgs.ConfigFile != "" && cmd.Name() != "netbench" {
-		return fmt.Errorf("Cannot use subcommand when config file flag used!")
+	if len(runner.Scenarios) > 0 {
+		return runner.InheritSettings(changedSettings(cmd, resetDuration))
 	}
-
 	return nil
 }
+
+// changedSettings returns the config keys set by the command line or the
+// environment, scenarios inherit them over the config file.
+func changedSettings(cmd *cobra.Command, resetDuration bool) []string {
+	var keys []string
+	for flag, key := range flagSettings {
+		if cmd.Flags().Changed(flag) || (key == "duration" && resetDuration) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
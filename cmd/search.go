@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/BatikanHyt/netbench/pkg/collector"
+	"github.com/BatikanHyt/netbench/pkg/protocols"
+	"github.com/spf13/cobra"
+)
+
+var search = &protocols.Search{}
+
+var searchCmd = &cobra.Command{
+	Use:     "search",
+	Short:   "Find the highest request rate that meets a latency and error SLO",
+	Long:    "Runs open-loop steps with the protocol of the config file, raising and then bisecting the rate until the SLO is violated",
+	PreRunE: validateSearchArgs,
+	Run:     runSearchCmd,
+}
+
+func init() {
+	searchCmd.Flags().Float64Var(&search.Percentile, "percentile", 99, fmt.Sprintf("Response time percentile of the latency SLO %v", collector.SummaryPercentiles))
+	searchCmd.Flags().DurationVar(&search.MaxLatency, "max-latency", 0, "Latency SLO for the selected percentile, 0 disables it")
+	searchCmd.Flags().Float64Var(&search.MaxErrorRate, "max-error-rate", 0.01, "Highest accepted share of failed or dropped requests (0-1)")
+	searchCmd.Flags().Float64Var(&search.MinRate, "min-rate", 10, "Rate of the first step in requests/sec")
+	searchCmd.Flags().Float64Var(&search.MaxRate, "max-rate", 100000, "Highest rate to probe in requests/sec")
+	searchCmd.Flags().DurationVar(&search.StepDuration, "step-duration", 30*time.Second, "Duration of every step")
+	searchCmd.Flags().Float64Var(&search.Tolerance, "tolerance", 0.05, "Stop when the search window is narrower than this share of the rate")
+	searchCmd.Flags().IntVar(&search.MaxSteps, "max-steps", 15, "Maximum number of steps")
+	rootCmd.AddCommand(searchCmd)
+}
+
+func validateSearchArgs(cmd *cobra.Command, args []string) error {
+	if rootCmdArgs.ConfigFile == "" {
+		return errors.New("Search needs a config file, use --config")
+	}
+	if _, ok := (collector.LatencySummary{}).Percentile(search.Percentile); !ok {
+		return fmt.Errorf("Invalid percentile %v. Valid percentiles: %v", search.Percentile, collector.SummaryPercentiles)
+	}
+	if search.MinRate <= 0 || search.MaxRate < search.MinRate {
+		return errors.New("Rates must satisfy 0 < min-rate <= max-rate")
+	}
+	if search.MaxErrorRate < 0 || search.MaxErrorRate > 1 {
+		return errors.New("Max error rate must be between 0 and 1")
+	}
+	if search.StepDuration <= 0 || search.MaxSteps < 1 {
+		return errors.New("Step duration and max steps must be positive")
+	}
+	return nil
+}
+
+func runSearchCmd(cmd *cobra.Command, args []string) {
+	if rootCmdArgs.PrintConfig {
+		printConfig()
+		return
+	}
+	best, steps := runner.Search(search)
+	protocols.PrintSearchResult(best, steps)
+}
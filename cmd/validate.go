@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/BatikanHyt/netbench/pkg/protocols"
+	"github.com/spf13/cobra"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate <config>",
+	Short: "Check a config file without running it",
+	Long:  "Reports every problem of a config file with its JSON path, e.g. unknown keys, wrong types and missing required fields",
+	Args:  cobra.ExactArgs(1),
+	Run:   runValidateCmd,
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+}
+
+func runValidateCmd(cmd *cobra.Command, args []string) {
+	data, err := protocols.ReadConfig(args[0])
+	if err == nil {
+		err = protocols.ValidateConfig(data)
+	}
+	if err != nil {
+		fmt.Printf("Invalid config %s:\n%s\n", args[0], err)
+		os.Exit(1)
+	}
+	fmt.Printf("Config %s is valid\n", args[0])
+}
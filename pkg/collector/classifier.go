@@ -0,0 +1,63 @@
+package collector
+
+// ErrorClass holds the entries that failed before getting a status, e.g. on
+// a refused connection.
+const ErrorClass = "error"
+
+// Classifier maps the status of a protocol entry to a status class and
+// decides whether the entry counts as a success. Entries with an error are
+// failed by the collector whatever the classifier says.
+type Classifier interface {
+	Name() string
+	// status classes in the order they are printed
+	Classes() []string
+	Classify(entry *Entry) (string, Outcome)
+}
+
+type HttpClassifier struct{}
+
+func (HttpClassifier) Name() string {
+	return "HTTP"
+}
+
+func (HttpClassifier) Classes() []string {
+	return []string{"1xx", "2xx", "3xx", "4xx", "5xx", "other"}
+}
+
+func (HttpClassifier) Classify(entry *Entry) (string, Outcome) {
+	if entry.Status < 200 {
+		return "1xx", Success
+	} else if entry.Status < 300 {
+		return "2xx", Success
+	} else if entry.Status < 400 {
+		return "3xx", Success
+	} else if entry.Status < 500 {
+		return "4xx", Failure
+	} else if entry.Status < 600 {
+		return "5xx", Failure
+	}
+	return "other", Failure
+}
+
+type SmtpClassifier struct{}
+
+func (SmtpClassifier) Name() string {
+	return "SMTP"
+}
+
+func (SmtpClassifier) Classes() []string {
+	return []string{"2xx", "3xx", "4xx", "5xx", "other"}
+}
+
+func (SmtpClassifier) Classify(entry *Entry) (string, Outcome) {
+	if entry.Status < 300 {
+		return "2xx", Success
+	} else if entry.Status < 400 {
+		return "3xx", Success
+	} else if entry.Status < 500 {
+		return "4xx", Failure
+	} else if entry.Status < 600 {
+		return "5xx", Failure
+	}
+	return "other", Failure
+}
@@ -0,0 +1,230 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatCollector aggregates the entries of any protocol, the classifier is the
+// only protocol specific part.
+type StatCollector struct {
+	GlobalStat     GlobalStatistic
+	ResponseStatus map[string]int // status classes and their count
+	StatChannel    chan *Entry
+	classifier     Classifier
+	submitLock     sync.RWMutex
+	closed         bool // set by Finished, later entries are discarded
+	options        Options
+	lock           sync.RWMutex
+	serviceHist    *Histogram
+	responseHist   *Histogram
+	phaseHists     map[string]*Histogram
+	phaseOrder     []string
+	steps          stepStats
+	errors         errorStats
+	timeline       *timeline
+}
+
+func NewStatCollector(classifier Classifier) *StatCollector {
+	statistic := &StatCollector{
+		StatChannel:    make(chan *Entry),
+		ResponseStatus: make(map[string]int),
+		classifier:     classifier,
+	}
+	return statistic
+}
+
+func CreateHttpStatCollector() *StatCollector {
+	return NewStatCollector(HttpClassifier{})
+}
+
+func CreateSmtpStatCollector() *StatCollector {
+	return NewStatCollector(SmtpClassifier{})
+}
+
+func (s *StatCollector) SetOptions(opts Options) {
+	s.options = opts
+}
+
+// Submit hands an entry to the running Consume. Entries of requests that
+// outlive the run, e.g. after an interrupt, are discarded.
+func (s *StatCollector) Submit(entry *Entry) {
+	s.submitLock.RLock()
+	defer s.submitLock.RUnlock()
+	if s.closed {
+		return
+	}
+	s.StatChannel <- entry
+}
+
+func (s *StatCollector) GetGlobalStats() *GlobalStatistic {
+	return &s.GlobalStat
+}
+
+// returns the count of every status class, e.g. 2xx
+func (s *StatCollector) GetResponseStatus() map[string]int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	status := make(map[string]int, len(s.ResponseStatus))
+	for class, count := range s.ResponseStatus {
+		status[class] = count
+	}
+	return status
+}
+
+// prints stats on every +10% process
+func (s *StatCollector) PrintProgressStats() {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	classes := make([]string, 0, len(s.classifier.Classes())+1)
+	for _, class := range append(s.classifier.Classes(), ErrorClass) {
+		classes = append(classes, fmt.Sprintf("%s:%d", class, s.ResponseStatus[class]))
+	}
+	fmt.Printf("%s Codes:\n %s\nCurrent Total Request: %d, Current Total Time: %s, Avg Service time %s\n",
+		s.classifier.Name(), strings.Join(classes, ", "),
+		s.GlobalStat.TotalRequest, s.GlobalStat.TotalDuration, s.GlobalStat.AverageDuration)
+}
+
+// classify fails every entry carrying an error, entries that never got a
+// status are put in the error class.
+func (s *StatCollector) classify(entry *Entry) (string, Outcome) {
+	if entry.Error != nil && entry.Status == 0 {
+		return ErrorClass, Failure
+	}
+	class, outcome := s.classifier.Classify(entry)
+	if entry.Error != nil {
+		outcome = Failure
+	}
+	return class, outcome
+}
+
+func (s *StatCollector) Consume(wg *sync.WaitGroup) {
+	defer wg.Done()
+	s.serviceHist = NewHistogram(s.options.Precision)
+	s.responseHist = NewHistogram(s.options.Precision)
+	start := s.options.Start
+	if start.IsZero() {
+		start = time.Now()
+		s.options.Start = start
+	}
+	s.timeline = newTimeline(start, s.options.Interval)
+	s.phaseHists = make(map[string]*Histogram)
+	s.phaseOrder = nil
+	s.steps = newStepStats()
+	s.errors = make(errorStats)
+	var avg_time time.Duration
+	var avg_resp time.Duration
+	var count int64
+	for entry := range s.StatChannel {
+		if s.options.RawLog != nil {
+			s.options.RawLog.Write(&RawRecord{
+				Start:     entry.Start,
+				Scheduled: entry.Scheduled,
+				Worker:    entry.Worker,
+				Status:    entry.Status,
+				Error:     entry.Error,
+				ReadSize:  entry.ReadSize,
+				WriteSize: entry.WriteSize,
+				BodyRead:  entry.BodyReadSize,
+				BodyWrite: entry.BodyWriteSize,
+				Duration:  entry.Duration,
+				Phases:    entry.Phases,
+				Labels:    entry.Labels,
+				Step:      entry.Step,
+			})
+		}
+		if entry.Error != nil && entry.Error.Kind == ErrorCancelled {
+			// cut short by the end of the run, its latency means nothing
+			s.lock.Lock()
+			s.GlobalStat.Cancelled++
+			s.lock.Unlock()
+			continue
+		}
+		count++
+		class, outcome := s.classify(entry)
+		entry.Outcome = outcome
+		s.lock.Lock()
+		s.GlobalStat.TotalRequest++
+		s.ResponseStatus[class]++
+		if outcome == Success {
+			s.GlobalStat.SuccessfulReq++
+		} else {
+			s.GlobalStat.FailedReq++
+		}
+		end := entry.Start.Add(entry.Duration).Sub(start)
+		if end > s.GlobalStat.TotalDuration {
+			s.GlobalStat.TotalDuration = end
+		}
+		avg_time += entry.Duration
+		avg_resp += entry.ResponseTime()
+		s.GlobalStat.AverageDuration = time.Duration(int64(avg_time) / count)
+		s.GlobalStat.AverageResponseTime = time.Duration(int64(avg_resp) / count)
+		s.GlobalStat.ReadSize += entry.ReadSize
+		s.GlobalStat.WriteSize += entry.WriteSize
+		s.GlobalStat.TotalSize += entry.ReadSize + entry.WriteSize
+		s.GlobalStat.BodyReadSize += entry.BodyReadSize
+		s.GlobalStat.BodyWriteSize += entry.BodyWriteSize
+		for key, value := range entry.Labels {
+			if s.GlobalStat.Labels == nil {
+				s.GlobalStat.Labels = make(map[string]map[string]int)
+			}
+			if s.GlobalStat.Labels[key] == nil {
+				s.GlobalStat.Labels[key] = make(map[string]int)
+			}
+			s.GlobalStat.Labels[key][value]++
+		}
+		if entry.Error != nil {
+			s.errors.add(entry.Error)
+		}
+		s.lock.Unlock()
+
+		for _, phase := range entry.Phases {
+			hist, ok := s.phaseHists[phase.Name]
+			if !ok {
+				hist = NewHistogram(s.options.Precision)
+				s.phaseHists[phase.Name] = hist
+				s.phaseOrder = append(s.phaseOrder, phase.Name)
+			}
+			hist.Record(phase.Duration)
+		}
+
+		if entry.Step != "" {
+			s.steps.add(entry.Step, entry.Duration, outcome == Failure, s.options.Precision)
+		}
+		s.serviceHist.Record(entry.Duration)
+		s.responseHist.Record(entry.ResponseTime())
+		s.timeline.add(entry.Start.Add(entry.Duration), entry.ResponseTime(),
+			outcome == Failure, entry.ReadSize+entry.WriteSize)
+	}
+	s.GlobalStat.ServiceTime = s.serviceHist.Summary()
+	s.GlobalStat.ResponseTime = s.responseHist.Summary()
+	s.GlobalStat.Distribution = s.responseHist.Distribution(distributionBars)
+	s.GlobalStat.Timeline = s.timeline.finish()
+	s.GlobalStat.Errors = s.errors.summaries()
+	s.GlobalStat.Steps = s.steps.summaries()
+	s.GlobalStat.Phases = nil
+	for _, name := range s.phaseOrder {
+		hist := s.phaseHists[name]
+		s.GlobalStat.Phases = append(s.GlobalStat.Phases, PhaseSummary{
+			Name:    name,
+			Count:   hist.Count(),
+			Latency: hist.Summary(),
+		})
+	}
+	if count == 0 {
+		return
+	}
+	size_in_mb := float64(s.GlobalStat.TotalSize) / (1 << 20) //For MB
+	s.GlobalStat.Throughput = size_in_mb / s.GlobalStat.TotalDuration.Seconds()
+}
+
+func (s *StatCollector) Finished() {
+	s.submitLock.Lock()
+	defer s.submitLock.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.StatChannel)
+	}
+}
@@ -0,0 +1,135 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Kinds of RequestError, the SMTP kinds tell a transient 4xx reply from a
+// permanent 5xx one.
+const (
+	ErrorDns       = "dns"
+	ErrorRefused   = "connection_refused"
+	ErrorReset     = "connection_reset"
+	ErrorTimeout   = "timeout"
+	ErrorTls       = "tls"
+	ErrorProtocol  = "protocol"
+	ErrorBodyRead  = "body_read"
+	ErrorTransient = "smtp_4xx"
+	ErrorPermanent = "smtp_5xx"
+	ErrorExtract   = "extract" // a value of a multi-step flow was missing from the response
+	ErrorOther     = "other"
+	// the request was still running when the run ended
+	ErrorCancelled = "cancelled"
+)
+
+const (
+	errorSamples     = 3   // sample messages kept in an ErrorSummary
+	errorMaxDistinct = 100 // distinct messages counted per error class
+)
+
+// RequestError is a classified failure of a request, Phase names the step
+// that failed, e.g. connect or ttfb.
+type RequestError struct {
+	Kind    string `json:"kind"`
+	Phase   string `json:"phase,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("%s error in %s: %s", e.Kind, e.Phase, e.Message)
+}
+
+// Class groups the errors of the same kind in the same phase.
+func (e *RequestError) Class() string {
+	if e.Phase == "" {
+		return e.Kind
+	}
+	return e.Kind + "@" + e.Phase
+}
+
+// ErrorSample is a distinct error message and how often it was seen.
+type ErrorSample struct {
+	Message string `json:"message"`
+	Count   int    `json:"count"`
+}
+
+// ErrorSummary counts the errors of one class with its most frequent
+// messages.
+type ErrorSummary struct {
+	Kind    string        `json:"kind"`
+	Phase   string        `json:"phase,omitempty"`
+	Count   int           `json:"count"`
+	Samples []ErrorSample `json:"samples"`
+}
+
+type errorCounter struct {
+	summary  ErrorSummary
+	messages map[string]int
+}
+
+// errorStats counts errors by class. Messages often carry addresses or
+// ports, so only the first distinct messages of every class are counted.
+type errorStats map[string]*errorCounter
+
+func (e errorStats) add(err *RequestError) {
+	counter, ok := e[err.Class()]
+	if !ok {
+		counter = &errorCounter{
+			summary:  ErrorSummary{Kind: err.Kind, Phase: err.Phase},
+			messages: make(map[string]int),
+		}
+		e[err.Class()] = counter
+	}
+	counter.summary.Count++
+	if _, ok := counter.messages[err.Message]; ok || len(counter.messages) < errorMaxDistinct {
+		counter.messages[err.Message]++
+	}
+}
+
+// merge adds the errors counted by other.
+func (e errorStats) merge(other errorStats) {
+	for class, counter := range other {
+		mine, ok := e[class]
+		if !ok {
+			mine = &errorCounter{
+				summary:  ErrorSummary{Kind: counter.summary.Kind, Phase: counter.summary.Phase},
+				messages: make(map[string]int),
+			}
+			e[class] = mine
+		}
+		mine.summary.Count += counter.summary.Count
+		for message, count := range counter.messages {
+			if _, ok := mine.messages[message]; ok || len(mine.messages) < errorMaxDistinct {
+				mine.messages[message] += count
+			}
+		}
+	}
+}
+
+// summaries returns the error classes, most frequent first.
+func (e errorStats) summaries() []ErrorSummary {
+	summaries := make([]ErrorSummary, 0, len(e))
+	for _, counter := range e {
+		summary := counter.summary
+		for message, count := range counter.messages {
+			summary.Samples = append(summary.Samples, ErrorSample{message, count})
+		}
+		sort.Slice(summary.Samples, func(i, j int) bool {
+			a, b := summary.Samples[i], summary.Samples[j]
+			return a.Count > b.Count || (a.Count == b.Count && a.Message < b.Message)
+		})
+		if len(summary.Samples) > errorSamples {
+			summary.Samples = summary.Samples[:errorSamples]
+		}
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		a, b := summaries[i], summaries[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Kind+a.Phase < b.Kind+b.Phase
+	})
+	return summaries
+}
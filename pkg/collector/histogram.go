@@ -0,0 +1,320 @@
+package collector
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+const (
+	DefaultPrecision = 3
+	// values are recorded in nanoseconds, everything below a microsecond
+	// falls into the same bucket
+	histogramLowest  = int64(time.Microsecond)
+	histogramHighest = int64(time.Hour)
+	// number of bars of the reported latency distribution
+	distributionBars = 40
+)
+
+// Histogram is a latency histogram in the style of HdrHistogram. It keeps a
+// fixed number of log-linear buckets, so memory is bounded by the precision
+// and the trackable range, while every recorded value keeps the configured
+// number of significant digits.
+type Histogram struct {
+	unitMagnitude               uint
+	subBucketHalfCountMagnitude uint
+	subBucketCount              int64
+	subBucketHalfCount          int64
+	subBucketMask               int64
+	counts                      []int64
+
+	total int64
+	min   int64
+	max   int64
+	sum   float64
+	sumSq float64
+}
+
+// NewHistogram creates a histogram tracking values from 1µs to 1h with the
+// given number of significant digits (1-5).
+func NewHistogram(precision int) *Histogram {
+	if precision < 1 || precision > 5 {
+		precision = DefaultPrecision
+	}
+	largestSingleUnit := 2 * int64(math.Pow10(precision))
+	subBucketCountMagnitude := uint(math.Ceil(math.Log2(float64(largestSingleUnit))))
+	h := &Histogram{
+		unitMagnitude:               uint(math.Floor(math.Log2(float64(histogramLowest)))),
+		subBucketHalfCountMagnitude: subBucketCountMagnitude - 1,
+	}
+	h.subBucketCount = 1 << subBucketCountMagnitude
+	h.subBucketHalfCount = h.subBucketCount / 2
+	h.subBucketMask = (h.subBucketCount - 1) << h.unitMagnitude
+
+	bucketCount := 1
+	smallestUntrackable := h.subBucketCount << h.unitMagnitude
+	for smallestUntrackable <= histogramHighest {
+		smallestUntrackable <<= 1
+		bucketCount++
+	}
+	h.counts = make([]int64, int64(bucketCount+1)*h.subBucketHalfCount)
+	h.Reset()
+	return h
+}
+
+// Reset clears every recorded value and keeps the allocated buckets.
+func (h *Histogram) Reset() {
+	for i := range h.counts {
+		h.counts[i] = 0
+	}
+	h.total = 0
+	h.min = math.MaxInt64
+	h.max = 0
+	h.sum = 0
+	h.sumSq = 0
+}
+
+// Record adds a duration to the histogram. Values outside the trackable range
+// are clamped, min and max stay exact.
+func (h *Histogram) Record(d time.Duration) {
+	v := int64(d)
+	if v < 0 {
+		v = 0
+	}
+	if v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+	h.total++
+	h.sum += float64(v)
+	h.sumSq += float64(v) * float64(v)
+	if v > histogramHighest {
+		v = histogramHighest
+	}
+	h.counts[h.countsIndex(v)]++
+}
+
+// Merge adds every value recorded in other to h. Values of a histogram with
+// another precision are moved to the bucket of h they fall into.
+func (h *Histogram) Merge(other *Histogram) {
+	if other == nil || other.total == 0 {
+		return
+	}
+	sameLayout := len(h.counts) == len(other.counts) && h.subBucketCount == other.subBucketCount
+	for i, c := range other.counts {
+		if c == 0 {
+			continue
+		}
+		if sameLayout {
+			h.counts[i] += c
+		} else {
+			h.counts[h.countsIndex(other.valueFromIndex(i))] += c
+		}
+	}
+	if other.min < h.min {
+		h.min = other.min
+	}
+	if other.max > h.max {
+		h.max = other.max
+	}
+	h.total += other.total
+	h.sum += other.sum
+	h.sumSq += other.sumSq
+}
+
+func (h *Histogram) Count() int64 {
+	return h.total
+}
+
+func (h *Histogram) Min() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.min)
+}
+
+func (h *Histogram) Max() time.Duration {
+	return time.Duration(h.max)
+}
+
+func (h *Histogram) Mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.sum / float64(h.total))
+}
+
+func (h *Histogram) StdDev() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	mean := h.sum / float64(h.total)
+	variance := h.sumSq/float64(h.total) - mean*mean
+	if variance < 0 {
+		variance = 0
+	}
+	return time.Duration(math.Sqrt(variance))
+}
+
+// ValueAtPercentile returns the highest value, within the histogram
+// precision, below which the given percentage (0-100) of values fall.
+func (h *Histogram) ValueAtPercentile(percentile float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	if percentile > 100 {
+		percentile = 100
+	}
+	countAtPercentile := int64(percentile/100*float64(h.total) + 0.5)
+	if countAtPercentile < 1 {
+		countAtPercentile = 1
+	}
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= countAtPercentile {
+			value := h.highestEquivalentValue(h.valueFromIndex(i))
+			if value > h.max {
+				value = h.max
+			}
+			return time.Duration(value)
+		}
+	}
+	return time.Duration(h.max)
+}
+
+// Bar is a single bucket of a histogram distribution.
+type Bar struct {
+	From  time.Duration `json:"from"`
+	To    time.Duration `json:"to"`
+	Count int64         `json:"count"`
+}
+
+// Distribution folds the recorded values into at most n equally sized bars
+// between min and the 99.9th percentile, the last bar also holds the tail up
+// to max so that a few outliers do not flatten the chart.
+func (h *Histogram) Distribution(n int) []Bar {
+	if h.total == 0 || n < 1 {
+		return nil
+	}
+	low, high := h.min, int64(h.ValueAtPercentile(99.9))
+	if high < low {
+		// values above the tracked range are capped below min
+		high = low
+	}
+	width := (high - low) / int64(n)
+	if width < 1 {
+		width = 1
+	}
+	bars := make([]Bar, 0, n)
+	for from := low; from <= high && len(bars) < n; from += width {
+		bars = append(bars, Bar{From: time.Duration(from), To: time.Duration(from + width)})
+	}
+	if len(bars) == 0 {
+		return nil
+	}
+	bars[len(bars)-1].To = time.Duration(h.max)
+	for i, c := range h.counts {
+		if c == 0 {
+			continue
+		}
+		pos := 0
+		if value := h.valueFromIndex(i); value > low {
+			pos = int((value - low) / width)
+		}
+		if pos >= len(bars) {
+			pos = len(bars) - 1
+		}
+		bars[pos].Count += c
+	}
+	return bars
+}
+
+func (h *Histogram) countsIndex(v int64) int {
+	bucketIdx := h.bucketIndex(v)
+	subBucketIdx := v >> (uint(bucketIdx) + h.unitMagnitude)
+	return int((int64(bucketIdx+1) << h.subBucketHalfCountMagnitude) + subBucketIdx - h.subBucketHalfCount)
+}
+
+func (h *Histogram) bucketIndex(v int64) int {
+	pow2Ceiling := 64 - bits.LeadingZeros64(uint64(v|h.subBucketMask))
+	return pow2Ceiling - int(h.unitMagnitude) - int(h.subBucketHalfCountMagnitude+1)
+}
+
+func (h *Histogram) valueFromIndex(idx int) int64 {
+	bucketIdx := int64(idx>>h.subBucketHalfCountMagnitude) - 1
+	subBucketIdx := int64(idx)&(h.subBucketHalfCount-1) + h.subBucketHalfCount
+	if bucketIdx < 0 {
+		subBucketIdx -= h.subBucketHalfCount
+		bucketIdx = 0
+	}
+	return subBucketIdx << (uint(bucketIdx) + h.unitMagnitude)
+}
+
+func (h *Histogram) highestEquivalentValue(v int64) int64 {
+	bucketIdx := h.bucketIndex(v)
+	subBucketIdx := v >> (uint(bucketIdx) + h.unitMagnitude)
+	adjustedBucket := bucketIdx
+	if subBucketIdx >= h.subBucketCount {
+		adjustedBucket++
+	}
+	lowest := subBucketIdx << (uint(bucketIdx) + h.unitMagnitude)
+	return lowest + int64(1)<<(h.unitMagnitude+uint(adjustedBucket)) - 1
+}
+
+// LatencySummary is the digest of a histogram reported in the statistics.
+type LatencySummary struct {
+	Min    time.Duration `json:"min"`
+	Max    time.Duration `json:"max"`
+	Mean   time.Duration `json:"mean"`
+	StdDev time.Duration `json:"stddev"`
+	P50    time.Duration `json:"p50"`
+	P75    time.Duration `json:"p75"`
+	P90    time.Duration `json:"p90"`
+	P95    time.Duration `json:"p95"`
+	P99    time.Duration `json:"p99"`
+	P999   time.Duration `json:"p99.9"`
+	P9999  time.Duration `json:"p99.99"`
+}
+
+// SummaryPercentiles lists the percentiles kept in a LatencySummary.
+var SummaryPercentiles = []float64{50, 75, 90, 95, 99, 99.9, 99.99}
+
+// Percentile returns the value of one of the SummaryPercentiles.
+func (s LatencySummary) Percentile(p float64) (time.Duration, bool) {
+	switch p {
+	case 50:
+		return s.P50, true
+	case 75:
+		return s.P75, true
+	case 90:
+		return s.P90, true
+	case 95:
+		return s.P95, true
+	case 99:
+		return s.P99, true
+	case 99.9:
+		return s.P999, true
+	case 99.99:
+		return s.P9999, true
+	}
+	return 0, false
+}
+
+func (h *Histogram) Summary() LatencySummary {
+	return LatencySummary{
+		Min:    h.Min(),
+		Max:    h.Max(),
+		Mean:   h.Mean(),
+		StdDev: h.StdDev(),
+		P50:    h.ValueAtPercentile(50),
+		P75:    h.ValueAtPercentile(75),
+		P90:    h.ValueAtPercentile(90),
+		P95:    h.ValueAtPercentile(95),
+		P99:    h.ValueAtPercentile(99),
+		P999:   h.ValueAtPercentile(99.9),
+		P9999:  h.ValueAtPercentile(99.99),
+	}
+}
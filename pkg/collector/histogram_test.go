@@ -0,0 +1,128 @@
+package collector
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestValueAtPercentile(t *testing.T) {
+	for precision := 1; precision <= 5; precision++ {
+		h := NewHistogram(precision)
+		for i := 1; i <= 10000; i++ {
+			h.Record(time.Duration(i) * time.Microsecond)
+		}
+		for _, tt := range []struct {
+			percentile float64
+			want       time.Duration
+		}{
+			{50, 5 * time.Millisecond},
+			{90, 9 * time.Millisecond},
+			{99, 9900 * time.Microsecond},
+			{99.9, 9990 * time.Microsecond},
+			{100, 10 * time.Millisecond},
+		} {
+			// a value keeps precision significant digits, but no more than
+			// the resolution of a microsecond
+			tolerance := math.Max(float64(tt.want)*math.Pow10(-precision), float64(time.Microsecond))
+			got := h.ValueAtPercentile(tt.percentile)
+			if diff := math.Abs(float64(got - tt.want)); diff > tolerance {
+				t.Errorf("precision %d: p%v = %s, want %s within %s", precision, tt.percentile, got, tt.want, time.Duration(tolerance))
+			}
+		}
+		if h.Count() != 10000 || h.Min() != time.Microsecond || h.Max() != 10*time.Millisecond {
+			t.Errorf("precision %d: count %d, min %s, max %s", precision, h.Count(), h.Min(), h.Max())
+		}
+	}
+}
+
+func TestValueAtPercentileBounds(t *testing.T) {
+	h := NewHistogram(DefaultPrecision)
+	if got := h.ValueAtPercentile(99); got != 0 {
+		t.Errorf("empty histogram p99 = %s, want 0", got)
+	}
+	h.Record(-time.Second)
+	h.Record(10 * time.Millisecond)
+	h.Record(2 * time.Hour)
+	if h.Min() != 0 {
+		t.Errorf("min = %s, want negative values recorded as 0", h.Min())
+	}
+	// values above the tracked range are counted in its last bucket, max
+	// stays exact
+	if got := h.ValueAtPercentile(100); got > 2*time.Hour || got < time.Hour {
+		t.Errorf("p100 = %s, want between 1h and 2h", got)
+	}
+	if h.Max() != 2*time.Hour {
+		t.Errorf("max = %s, want 2h", h.Max())
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	all := NewHistogram(DefaultPrecision)
+	odd := NewHistogram(DefaultPrecision)
+	even := NewHistogram(2)
+	for i := 1; i <= 1000; i++ {
+		d := time.Duration(i) * 100 * time.Microsecond
+		all.Record(d)
+		if i%2 == 1 {
+			odd.Record(d)
+		} else {
+			even.Record(d)
+		}
+	}
+	odd.Merge(even)
+	if odd.Count() != all.Count() || odd.Min() != all.Min() || odd.Max() != all.Max() || odd.Mean() != all.Mean() {
+		t.Fatalf("merged count %d min %s max %s mean %s, want %d %s %s %s", odd.Count(), odd.Min(), odd.Max(), odd.Mean(),
+			all.Count(), all.Min(), all.Max(), all.Mean())
+	}
+	// values of the histogram with less precision keep its precision
+	for _, percentile := range []float64{50, 90, 99} {
+		got, want := odd.ValueAtPercentile(percentile), all.ValueAtPercentile(percentile)
+		if diff := math.Abs(float64(got-want)) / float64(want); diff > 0.01 {
+			t.Errorf("merged p%v = %s, want %s", percentile, got, want)
+		}
+	}
+}
+
+func TestDistribution(t *testing.T) {
+	h := NewHistogram(DefaultPrecision)
+	for i := 1; i <= 100; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+	bars := h.Distribution(10)
+	if len(bars) == 0 || len(bars) > 10 {
+		t.Fatalf("got %d bars, want 1-10", len(bars))
+	}
+	var total int64
+	for _, bar := range bars {
+		total += bar.Count
+	}
+	if total != 100 {
+		t.Errorf("bars hold %d values, want 100", total)
+	}
+	if bars[0].From != time.Millisecond {
+		t.Errorf("first bar starts at %s, want 1ms", bars[0].From)
+	}
+	if last := bars[len(bars)-1]; last.To != 100*time.Millisecond {
+		t.Errorf("last bar ends at %s, want 100ms", last.To)
+	}
+}
+
+func TestDistributionAboveRange(t *testing.T) {
+	h := NewHistogram(DefaultPrecision)
+	h.Record(90 * time.Minute)
+	h.Record(2 * time.Hour)
+	bars := h.Distribution(40)
+	if len(bars) != 1 {
+		t.Fatalf("got %d bars, want 1", len(bars))
+	}
+	if bars[0].Count != 2 || bars[0].To != 2*time.Hour {
+		t.Errorf("got bar %+v, want 2 values up to 2h", bars[0])
+	}
+}
+
+func TestDistributionEmpty(t *testing.T) {
+	if bars := NewHistogram(DefaultPrecision).Distribution(10); bars != nil {
+		t.Errorf("got %v for an empty histogram, want nil", bars)
+	}
+}
@@ -0,0 +1,142 @@
+package collector
+
+import (
+	"strings"
+	"time"
+)
+
+// mergedClassifier names the statistics merged from the collectors of
+// several protocols.
+type mergedClassifier []Classifier
+
+func (m mergedClassifier) Name() string {
+	names := make([]string, 0, len(m))
+	for _, classifier := range m {
+		names = append(names, classifier.Name())
+	}
+	return strings.Join(names, "+")
+}
+
+func (m mergedClassifier) Classes() []string {
+	var classes []string
+	seen := make(map[string]bool)
+	for _, classifier := range m {
+		for _, class := range classifier.Classes() {
+			class = m.class(classifier, class)
+			if !seen[class] {
+				seen[class] = true
+				classes = append(classes, class)
+			}
+		}
+	}
+	return classes
+}
+
+// class returns the merged name of a class of classifier. When protocols
+// are mixed the class is prefixed with the protocol, e.g. http_2xx, so that
+// HTTP status classes and SMTP reply codes are not counted together.
+func (m mergedClassifier) class(classifier Classifier, class string) string {
+	for _, other := range m {
+		if other.Name() != classifier.Name() {
+			return strings.ToLower(classifier.Name()) + "_" + class
+		}
+	}
+	return class
+}
+
+func (m mergedClassifier) Classify(entry *Entry) (string, Outcome) {
+	if len(m) == 0 {
+		return ErrorClass, Failure
+	}
+	return m[0].Classify(entry)
+}
+
+// Merge combines finished collectors, e.g. of scenarios running side by side,
+// into the statistics of a single run started at start. Latencies are merged
+// histogram by histogram, so percentiles stay exact within the precision. The
+// combined statistics have no timeline, timelines are kept per collector.
+func Merge(start time.Time, collectors ...*StatCollector) *StatCollector {
+	precision := DefaultPrecision
+	if len(collectors) > 0 && collectors[0].options.Precision != 0 {
+		precision = collectors[0].options.Precision
+	}
+	classifiers := make(mergedClassifier, 0, len(collectors))
+	for _, c := range collectors {
+		classifiers = append(classifiers, c.classifier)
+	}
+	merged := NewStatCollector(nil)
+	merged.closed = true
+	merged.options = Options{Precision: precision, Start: start}
+	merged.serviceHist = NewHistogram(precision)
+	merged.responseHist = NewHistogram(precision)
+	merged.phaseHists = make(map[string]*Histogram)
+	merged.errors = make(errorStats)
+	merged.steps = newStepStats()
+	g := &merged.GlobalStat
+	for _, c := range collectors {
+		s := &c.GlobalStat
+		g.TotalRequest += s.TotalRequest
+		g.SuccessfulReq += s.SuccessfulReq
+		g.FailedReq += s.FailedReq
+		g.Cancelled += s.Cancelled
+		g.TotalSize += s.TotalSize
+		g.ReadSize += s.ReadSize
+		g.WriteSize += s.WriteSize
+		g.BodyReadSize += s.BodyReadSize
+		g.BodyWriteSize += s.BodyWriteSize
+		if s.TotalRequest > 0 {
+			if end := c.options.Start.Sub(start) + s.TotalDuration; end > g.TotalDuration {
+				g.TotalDuration = end
+			}
+		}
+		for key, values := range s.Labels {
+			if g.Labels == nil {
+				g.Labels = make(map[string]map[string]int)
+			}
+			if g.Labels[key] == nil {
+				g.Labels[key] = make(map[string]int)
+			}
+			for value, count := range values {
+				g.Labels[key][value] += count
+			}
+		}
+		for class, count := range c.ResponseStatus {
+			merged.ResponseStatus[classifiers.class(c.classifier, class)] += count
+		}
+		merged.serviceHist.Merge(c.serviceHist)
+		merged.responseHist.Merge(c.responseHist)
+		for _, name := range c.phaseOrder {
+			hist, ok := merged.phaseHists[name]
+			if !ok {
+				hist = NewHistogram(precision)
+				merged.phaseHists[name] = hist
+				merged.phaseOrder = append(merged.phaseOrder, name)
+			}
+			hist.Merge(c.phaseHists[name])
+		}
+		merged.errors.merge(c.errors)
+		merged.steps.merge(c.steps, precision)
+	}
+	merged.classifier = classifiers
+
+	g.AverageDuration = merged.serviceHist.Mean()
+	g.AverageResponseTime = merged.responseHist.Mean()
+	g.ServiceTime = merged.serviceHist.Summary()
+	g.ResponseTime = merged.responseHist.Summary()
+	g.Distribution = merged.responseHist.Distribution(distributionBars)
+	g.Errors = merged.errors.summaries()
+	g.Steps = merged.steps.summaries()
+	for _, name := range merged.phaseOrder {
+		hist := merged.phaseHists[name]
+		g.Phases = append(g.Phases, PhaseSummary{
+			Name:    name,
+			Count:   hist.Count(),
+			Latency: hist.Summary(),
+		})
+	}
+	if g.TotalRequest > 0 && g.TotalDuration > 0 {
+		size_in_mb := float64(g.TotalSize) / (1 << 20) //For MB
+		g.Throughput = size_in_mb / g.TotalDuration.Seconds()
+	}
+	return merged
+}
@@ -0,0 +1,52 @@
+package collector
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collect returns a finished collector of an entry for each status.
+func collect(classifier Classifier, start time.Time, statuses ...int) *StatCollector {
+	c := NewStatCollector(classifier)
+	c.SetOptions(Options{Precision: DefaultPrecision, Interval: DefaultInterval, Start: start})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go c.Consume(&wg)
+	for _, status := range statuses {
+		c.Submit(&Entry{Start: start, Status: status, Duration: time.Millisecond})
+	}
+	c.Finished()
+	wg.Wait()
+	return c
+}
+
+func TestMergeStatus(t *testing.T) {
+	start := time.Now()
+	tests := []struct {
+		name       string
+		collectors []*StatCollector
+		want       map[string]int
+	}{
+		{"same protocol", []*StatCollector{
+			collect(HttpClassifier{}, start, 200, 200, 404),
+			collect(HttpClassifier{}, start, 201, 500),
+		}, map[string]int{"2xx": 3, "4xx": 1, "5xx": 1}},
+		{"mixed protocols", []*StatCollector{
+			collect(HttpClassifier{}, start, 200, 200, 404),
+			collect(SmtpClassifier{}, start, 250, 550),
+		}, map[string]int{"http_2xx": 2, "http_4xx": 1, "smtp_2xx": 1, "smtp_5xx": 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged := Merge(start, tt.collectors...)
+			if got := merged.GetResponseStatus(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got status %v, want %v", got, tt.want)
+			}
+			if merged.GlobalStat.TotalRequest != 5 {
+				t.Errorf("got %d requests, want 5", merged.GlobalStat.TotalRequest)
+			}
+		})
+	}
+}
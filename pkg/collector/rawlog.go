@@ -0,0 +1,449 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	RawLogNdjson = "ndjson"
+	RawLogBinary = "binary"
+
+	rawLogVersion = 1
+
+	// kinds of the binary records
+	rawKindRecord  = 0
+	rawKindTrailer = 1
+)
+
+var ValidRawLogFormats = []string{RawLogNdjson, RawLogBinary}
+
+// magic bytes starting a binary raw log
+var rawLogMagic = []byte("NBRL")
+
+// RawLogHeader is the first record of a raw log and describes the run.
+type RawLogHeader struct {
+	Netbench   int       `json:"netbench"` // format version
+	Protocol   string    `json:"protocol"`
+	Start      time.Time `json:"start"`
+	Concurency int       `json:"concurency"`
+	Rate       float64   `json:"rate"`
+}
+
+// RawLogTrailer is the last record of a raw log, written once the run is
+// over. The log of a run that never finished, e.g. after a forced exit, has
+// none.
+type RawLogTrailer struct {
+	Dropped     int64 `json:"dropped"`
+	Interrupted bool  `json:"interrupted"`
+}
+
+// rawLine is a line of an NDJSON raw log, either a record or the trailer.
+type rawLine struct {
+	RawRecord
+	Trailer *RawLogTrailer `json:"trailer,omitempty"`
+}
+
+// RawRecord is a single request as written to the raw log.
+type RawRecord struct {
+	Start     time.Time         `json:"ts"`
+	Scheduled time.Time         `json:"scheduled"`
+	Worker    int               `json:"worker"`
+	Status    int               `json:"status"`
+	Error     *RequestError     `json:"error,omitempty"`
+	ReadSize  int64             `json:"read"`
+	WriteSize int64             `json:"write"`
+	BodyRead  int64             `json:"bodyRead"`
+	BodyWrite int64             `json:"bodyWrite"`
+	Duration  time.Duration     `json:"duration"`
+	Phases    []Phase           `json:"phases,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Step      string            `json:"step,omitempty"`
+}
+
+// RawLogWriter streams every consumed entry to a file as NDJSON or as a
+// compact binary format for high request rates.
+type RawLogWriter struct {
+	format string
+	header RawLogHeader
+	file   *os.File
+	w      *bufio.Writer
+	buf    []byte
+}
+
+func CreateRawLog(path string, format string, header RawLogHeader) (*RawLogWriter, error) {
+	if format != RawLogNdjson && format != RawLogBinary {
+		return nil, fmt.Errorf("Invalid raw log format %s. Valid formats: %v", format, ValidRawLogFormats)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	header.Netbench = rawLogVersion
+	l := &RawLogWriter{
+		format: format,
+		header: header,
+		file:   file,
+		w:      bufio.NewWriterSize(file, 64*1024),
+		buf:    make([]byte, binary.MaxVarintLen64),
+	}
+	if format == RawLogNdjson {
+		err = l.writeJson(header)
+	} else {
+		err = l.writeBinaryHeader()
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *RawLogWriter) writeJson(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	l.w.Write(data)
+	return l.w.WriteByte('\n')
+}
+
+func (l *RawLogWriter) writeBinaryHeader() error {
+	l.w.Write(rawLogMagic)
+	l.w.WriteByte(rawLogVersion)
+	return l.putJson(l.header)
+}
+
+// putJson writes v as JSON prefixed by its length.
+func (l *RawLogWriter) putJson(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	l.putUvarint(uint64(len(data)))
+	_, err = l.w.Write(data)
+	return err
+}
+
+func (l *RawLogWriter) putUvarint(v uint64) {
+	n := binary.PutUvarint(l.buf[:binary.MaxVarintLen64], v)
+	l.w.Write(l.buf[:n])
+}
+
+func (l *RawLogWriter) putVarint(v int64) {
+	n := binary.PutVarint(l.buf[:binary.MaxVarintLen64], v)
+	l.w.Write(l.buf[:n])
+}
+
+// Write appends a record. Binary records store times as offsets from the
+// start of the run and every number as a varint.
+func (l *RawLogWriter) Write(record *RawRecord) error {
+	if l.format == RawLogNdjson {
+		return l.writeJson(record)
+	}
+	l.w.WriteByte(rawKindRecord)
+	l.putVarint(int64(record.Start.Sub(l.header.Start)))
+	scheduled := int64(0)
+	if !record.Scheduled.IsZero() {
+		scheduled = int64(record.Start.Sub(record.Scheduled))
+	}
+	l.putVarint(scheduled)
+	l.putUvarint(uint64(record.Worker))
+	l.putVarint(int64(record.Status))
+	// an empty kind marks a record without error
+	if record.Error != nil {
+		l.putString(record.Error.Kind)
+		l.putString(record.Error.Phase)
+		l.putString(record.Error.Message)
+	} else {
+		l.putString("")
+	}
+	l.putVarint(record.ReadSize)
+	l.putVarint(record.WriteSize)
+	l.putVarint(record.BodyRead)
+	l.putVarint(record.BodyWrite)
+	l.putVarint(int64(record.Duration))
+	l.putUvarint(uint64(len(record.Phases)))
+	for _, phase := range record.Phases {
+		l.putString(phase.Name)
+		l.putVarint(int64(phase.Duration))
+	}
+	keys := make([]string, 0, len(record.Labels))
+	for key := range record.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	l.putUvarint(uint64(len(keys)))
+	for _, key := range keys {
+		l.putString(key)
+		l.putString(record.Labels[key])
+	}
+	l.putString(record.Step)
+	return nil
+}
+
+// WriteTrailer appends the trailer, no record may follow it.
+func (l *RawLogWriter) WriteTrailer(trailer RawLogTrailer) error {
+	if l.format == RawLogNdjson {
+		return l.writeJson(struct {
+			Trailer *RawLogTrailer `json:"trailer"`
+		}{&trailer})
+	}
+	l.w.WriteByte(rawKindTrailer)
+	return l.putJson(trailer)
+}
+
+func (l *RawLogWriter) putString(s string) {
+	l.putUvarint(uint64(len(s)))
+	l.w.WriteString(s)
+}
+
+func (l *RawLogWriter) Close() error {
+	if err := l.w.Flush(); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
+
+// RawLogReader reads back a raw log written in either format.
+type RawLogReader struct {
+	Header  RawLogHeader
+	Trailer *RawLogTrailer // set once the trailer is read, nil if there is none
+	binary  bool
+	file    *os.File
+	r       *bufio.Reader
+}
+
+func OpenRawLog(path string) (*RawLogReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	l := &RawLogReader{file: file, r: bufio.NewReaderSize(file, 64*1024)}
+	magic, err := l.r.Peek(len(rawLogMagic))
+	if err == nil && bytes.Equal(magic, rawLogMagic) {
+		l.binary = true
+		err = l.readBinaryHeader()
+	} else {
+		err = l.readJson(&l.Header)
+	}
+	if err == nil && l.Header.Netbench != rawLogVersion {
+		err = fmt.Errorf("Unsupported raw log version %d", l.Header.Netbench)
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("Invalid raw log header: %s", err)
+	}
+	return l, nil
+}
+
+func (l *RawLogReader) readJson(v interface{}) error {
+	line, err := l.r.ReadBytes('\n')
+	if err != nil && !(err == io.EOF && len(line) > 0) {
+		return err
+	}
+	return json.Unmarshal(line, v)
+}
+
+func (l *RawLogReader) readBinaryHeader() error {
+	l.r.Discard(len(rawLogMagic))
+	if _, err := l.r.ReadByte(); err != nil {
+		return err
+	}
+	return l.readBinaryJson(&l.Header)
+}
+
+func (l *RawLogReader) readBinaryJson(v interface{}) error {
+	size, err := binary.ReadUvarint(l.r)
+	if err != nil {
+		return err
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(l.r, data); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Next returns the next record, or io.EOF once the log is exhausted. The
+// trailer ends the log and is kept in Trailer.
+func (l *RawLogReader) Next() (*RawRecord, error) {
+	if l.Trailer != nil {
+		return nil, io.EOF
+	}
+	if !l.binary {
+		line := &rawLine{}
+		if err := l.readJson(line); err != nil {
+			return nil, err
+		}
+		if line.Trailer != nil {
+			l.Trailer = line.Trailer
+			return nil, io.EOF
+		}
+		return &line.RawRecord, nil
+	}
+	kind, err := l.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case rawKindRecord:
+	case rawKindTrailer:
+		trailer := &RawLogTrailer{}
+		if err := l.readBinaryJson(trailer); err != nil {
+			return nil, fmt.Errorf("Invalid raw log trailer: %s", err)
+		}
+		l.Trailer = trailer
+		return nil, io.EOF
+	default:
+		return nil, fmt.Errorf("Invalid raw log record kind %d", kind)
+	}
+	record := &RawRecord{}
+	var values [10]int64
+	var requestError *RequestError
+	for i := range values {
+		var err error
+		switch i {
+		case 2:
+			var v uint64
+			v, err = binary.ReadUvarint(l.r)
+			values[i] = int64(v)
+		case 4:
+			requestError, err = l.readError()
+		default:
+			values[i], err = binary.ReadVarint(l.r)
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = errors.New("truncated raw log record")
+			}
+			return nil, err
+		}
+	}
+	record.Start = l.Header.Start.Add(time.Duration(values[0]))
+	record.Scheduled = record.Start.Add(-time.Duration(values[1]))
+	record.Worker = int(values[2])
+	record.Status = int(values[3])
+	record.Error = requestError
+	record.ReadSize = values[5]
+	record.WriteSize = values[6]
+	record.BodyRead = values[7]
+	record.BodyWrite = values[8]
+	record.Duration = time.Duration(values[9])
+	if err := l.readExtensions(record); err != nil {
+		if err == io.EOF {
+			err = errors.New("truncated raw log record")
+		}
+		return nil, err
+	}
+	return record, nil
+}
+
+// readExtensions reads the variable length phases, labels and step that
+// follow the fixed fields of a binary record.
+func (l *RawLogReader) readExtensions(record *RawRecord) error {
+	count, err := binary.ReadUvarint(l.r)
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < count; i++ {
+		name, err := l.readString()
+		if err != nil {
+			return err
+		}
+		duration, err := binary.ReadVarint(l.r)
+		if err != nil {
+			return err
+		}
+		record.Phases = append(record.Phases, Phase{Name: name, Duration: time.Duration(duration)})
+	}
+	count, err = binary.ReadUvarint(l.r)
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < count; i++ {
+		key, err := l.readString()
+		if err != nil {
+			return err
+		}
+		value, err := l.readString()
+		if err != nil {
+			return err
+		}
+		if record.Labels == nil {
+			record.Labels = make(map[string]string)
+		}
+		record.Labels[key] = value
+	}
+	record.Step, err = l.readString()
+	return err
+}
+
+func (l *RawLogReader) readError() (*RequestError, error) {
+	kind, err := l.readString()
+	if err != nil || kind == "" {
+		return nil, err
+	}
+	requestError := &RequestError{Kind: kind}
+	if requestError.Phase, err = l.readString(); err != nil {
+		return nil, err
+	}
+	if requestError.Message, err = l.readString(); err != nil {
+		return nil, err
+	}
+	return requestError, nil
+}
+
+func (l *RawLogReader) readString() (string, error) {
+	size, err := binary.ReadUvarint(l.r)
+	if err != nil {
+		return "", err
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(l.r, data); err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Replay feeds every remaining record into a collector whose Consume is
+// running.
+func (l *RawLogReader) Replay(stat StatBase) error {
+	for {
+		record, err := l.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		stat.Submit(&Entry{
+			Status:        record.Status,
+			WriteSize:     record.WriteSize,
+			ReadSize:      record.ReadSize,
+			BodyWriteSize: record.BodyWrite,
+			BodyReadSize:  record.BodyRead,
+			Worker:        record.Worker,
+			Scheduled:     record.Scheduled,
+			Start:         record.Start,
+			Duration:      record.Duration,
+			Phases:        record.Phases,
+			Labels:        record.Labels,
+			Step:          record.Step,
+			Error:         record.Error,
+		})
+	}
+}
+
+func (l *RawLogReader) Close() error {
+	return l.file.Close()
+}
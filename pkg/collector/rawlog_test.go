@@ -0,0 +1,160 @@
+package collector
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func rawLogRecords(start time.Time) []RawRecord {
+	return []RawRecord{
+		{
+			Start:     start.Add(10 * time.Millisecond),
+			Scheduled: start.Add(8 * time.Millisecond),
+			Worker:    3,
+			Status:    200,
+			ReadSize:  1200,
+			WriteSize: 80,
+			BodyRead:  1000,
+			Duration:  4 * time.Millisecond,
+			Phases:    []Phase{{Name: "connect", Duration: time.Millisecond}, {Name: "ttfb", Duration: 2 * time.Millisecond}},
+			Labels:    map[string]string{"connection": "new"},
+			Step:      "login",
+		},
+		{
+			Start:     start.Add(20 * time.Millisecond),
+			Scheduled: start.Add(20 * time.Millisecond),
+			Worker:    0,
+			Error:     &RequestError{Kind: ErrorTimeout, Phase: "ttfb", Message: "context deadline exceeded"},
+			WriteSize: 80,
+			BodyWrite: 20,
+			Duration:  time.Second,
+		},
+	}
+}
+
+func TestRawLogRoundTrip(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	header := RawLogHeader{Protocol: "http", Start: start, Concurency: 4, Rate: 100}
+	trailer := RawLogTrailer{Dropped: 7, Interrupted: true}
+	for _, format := range ValidRawLogFormats {
+		t.Run(format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "raw."+format)
+			w, err := CreateRawLog(path, format, header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			records := rawLogRecords(start)
+			for i := range records {
+				if err := w.Write(&records[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.WriteTrailer(trailer); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := OpenRawLog(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			if r.Header.Protocol != "http" || !r.Header.Start.Equal(start) || r.Header.Concurency != 4 || r.Header.Rate != 100 {
+				t.Errorf("got header %+v", r.Header)
+			}
+			for i, want := range records {
+				got, err := r.Next()
+				if err != nil {
+					t.Fatalf("record %d: %s", i, err)
+				}
+				if !got.Start.Equal(want.Start) || !got.Scheduled.Equal(want.Scheduled) {
+					t.Errorf("record %d: start %s scheduled %s, want %s %s", i, got.Start, got.Scheduled, want.Start, want.Scheduled)
+				}
+				got.Start, got.Scheduled = want.Start, want.Scheduled
+				if !reflect.DeepEqual(*got, want) {
+					t.Errorf("record %d:\ngot  %+v\nwant %+v", i, *got, want)
+				}
+			}
+			if _, err := r.Next(); err != io.EOF {
+				t.Fatalf("got %v after the records, want EOF", err)
+			}
+			if r.Trailer == nil || *r.Trailer != trailer {
+				t.Errorf("got trailer %+v, want %+v", r.Trailer, trailer)
+			}
+		})
+	}
+}
+
+func TestRawLogWithoutTrailer(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, format := range ValidRawLogFormats {
+		path := filepath.Join(t.TempDir(), "raw."+format)
+		w, err := CreateRawLog(path, format, RawLogHeader{Protocol: "smtp", Start: start})
+		if err != nil {
+			t.Fatal(err)
+		}
+		records := rawLogRecords(start)
+		w.Write(&records[0])
+		w.Close()
+
+		r, err := OpenRawLog(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Next(); err != nil {
+			t.Errorf("%s: %s", format, err)
+		}
+		if _, err := r.Next(); err != io.EOF {
+			t.Errorf("%s: got %v after the records, want EOF", format, err)
+		}
+		if r.Trailer != nil {
+			t.Errorf("%s: got trailer %+v of a log without one", format, r.Trailer)
+		}
+		r.Close()
+	}
+}
+
+func TestRawLogTruncated(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "raw.bin")
+	w, err := CreateRawLog(path, RawLogBinary, RawLogHeader{Protocol: "http", Start: start})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := rawLogRecords(start)
+	w.Write(&records[0])
+	w.Close()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, info.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := OpenRawLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := r.Next(); err == nil || err == io.EOF {
+		t.Errorf("got %v reading a truncated record, want an error", err)
+	}
+}
+
+func TestRawLogVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "raw.ndjson")
+	if err := os.WriteFile(path, []byte(`{"netbench":2,"protocol":"http"}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := OpenRawLog(path); err == nil {
+		r.Close()
+		t.Errorf("opened a raw log of version 2")
+	}
+}
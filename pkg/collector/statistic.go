@@ -5,35 +5,120 @@ import (
 	"time"
 )
 
-type StatEntry interface{}
+// Outcome tells whether an entry counts as a successful request.
+type Outcome int
 
-type HttpEntry struct {
-	ResponseCode int
-	WriteSize    int64
-	ReadSize     int64
-	Duration     time.Duration
+const (
+	Success Outcome = iota + 1
+	Failure
+)
+
+// Entry is a single request or transaction reported by a protocol client.
+type Entry struct {
+	Status    int     // protocol status code, e.g. the HTTP status or SMTP reply code, 0 if none
+	Outcome   Outcome // set by the collector's classifier
+	WriteSize int64   // bytes written on the wire, headers included
+	ReadSize  int64   // bytes read from the wire, headers included
+	// payload bytes sent and received, after decompression
+	BodyWriteSize int64
+	BodyReadSize  int64
+	Worker        int
+	Scheduled     time.Time     // intended send time given by the runner
+	Start         time.Time     // actual send time
+	Duration      time.Duration // service time, measured from Start
+	// protocol steps of the request in the order they happened
+	Phases []Phase
+	Labels map[string]string // counted per key and value by the collector
+	Step   string            // step of a multi-step flow, statistics are also kept per step
+	Error  *RequestError     // set when the request failed
+}
+
+// Phase is the time a request spent in one protocol step, e.g. the DNS
+// lookup of an HTTP request.
+type Phase struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+}
+
+// PhaseSummary holds the latency of a phase over the entries that went
+// through it.
+type PhaseSummary struct {
+	Name    string         `json:"name"`
+	Count   int64          `json:"count"`
+	Latency LatencySummary `json:"latency"`
 }
 
-type SmtpEntry struct {
-	ResponseCode int
-	WriteSize    int64
-	ReadSize     int64
-	Duration     time.Duration
+// StepSummary holds the statistics of a step of multi-step flows, Latency
+// is the service time of the step.
+type StepSummary struct {
+	Name    string         `json:"name"`
+	Count   int64          `json:"count"`
+	Failed  int64          `json:"failed"`
+	Latency LatencySummary `json:"latency"`
 }
 
+// ResponseTime returns the latency measured from the intended send time,
+// which corrects for coordinated omission when the sender was held back.
+func (e *Entry) ResponseTime() time.Duration {
+	return correctedLatency(e.Scheduled, e.Start, e.Duration)
+}
+
+func correctedLatency(scheduled time.Time, start time.Time, service time.Duration) time.Duration {
+	if scheduled.IsZero() || start.Before(scheduled) {
+		return service
+	}
+	return start.Sub(scheduled) + service
+}
+
+// GlobalStatistic holds the aggregates of a run, durations are serialized in
+// nanoseconds and Throughput in MB/s.
 type GlobalStatistic struct {
-	TotalRequest    int
-	TotalDuration   time.Duration
-	SuccessfulReq   int
-	FailedReq       int
-	AverageDuration time.Duration
-	Throughput      float64
-	TotalSize       int64
+	TotalRequest  int           `json:"totalRequest"`
+	TotalDuration time.Duration `json:"totalDuration"`
+	SuccessfulReq int           `json:"successfulRequest"`
+	FailedReq     int           `json:"failedRequest"`
+	// requests cancelled by the end of the run, not part of any other figure
+	Cancelled       int           `json:"cancelled"`
+	AverageDuration time.Duration `json:"averageDuration"` // mean service time
+	// mean response time measured from the intended send time
+	AverageResponseTime time.Duration `json:"averageResponseTime"`
+	Throughput          float64       `json:"throughput"`
+	TotalSize           int64         `json:"totalSize"` // bytes on the wire
+	ReadSize            int64         `json:"readSize"`
+	WriteSize           int64         `json:"writeSize"`
+	// payload bytes, without protocol framing and headers
+	BodyReadSize  int64          `json:"bodyReadSize"`
+	BodyWriteSize int64          `json:"bodyWriteSize"`
+	ServiceTime   LatencySummary `json:"serviceTime"`
+	// response time measured from the intended send time
+	ResponseTime LatencySummary `json:"responseTime"`
+	// response time histogram folded into bars for charts
+	Distribution []Bar           `json:"distribution,omitempty"`
+	Timeline     []TimelinePoint `json:"timeline,omitempty"`
+	// phases in the order they were first seen
+	Phases []PhaseSummary `json:"phases,omitempty"`
+	// steps in the order they were first seen
+	Steps []StepSummary `json:"steps,omitempty"`
+	// count of every label value by label key, e.g. connection: reused
+	Labels map[string]map[string]int `json:"labels,omitempty"`
+	// error classes, most frequent first
+	Errors []ErrorSummary `json:"errors,omitempty"`
+}
+
+// Options tunes how a collector aggregates the entries it consumes.
+type Options struct {
+	Precision int           // significant digits kept by the latency histograms
+	Interval  time.Duration // length of a timeline interval
+	Start     time.Time     // start of the run, defaults to the start of Consume
+	RawLog    *RawLogWriter // when set every entry is appended to the log
 }
 
 type StatBase interface {
+	SetOptions(opts Options)
+	Submit(entry *Entry)
 	Consume(wg *sync.WaitGroup)
 	Finished()
 	GetGlobalStats() *GlobalStatistic
+	GetResponseStatus() map[string]int
 	PrintProgressStats()
 }
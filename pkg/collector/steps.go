@@ -0,0 +1,58 @@
+package collector
+
+import "time"
+
+type stepCounter struct {
+	hist   *Histogram
+	failed int64
+}
+
+// stepStats keeps the statistics of the steps of multi-step flows.
+type stepStats struct {
+	counters map[string]*stepCounter
+	order    []string
+}
+
+func newStepStats() stepStats {
+	return stepStats{counters: make(map[string]*stepCounter)}
+}
+
+func (s *stepStats) counter(name string, precision int) *stepCounter {
+	counter, ok := s.counters[name]
+	if !ok {
+		counter = &stepCounter{hist: NewHistogram(precision)}
+		s.counters[name] = counter
+		s.order = append(s.order, name)
+	}
+	return counter
+}
+
+func (s *stepStats) add(name string, duration time.Duration, failed bool, precision int) {
+	counter := s.counter(name, precision)
+	counter.hist.Record(duration)
+	if failed {
+		counter.failed++
+	}
+}
+
+func (s *stepStats) merge(other stepStats, precision int) {
+	for _, name := range other.order {
+		counter := s.counter(name, precision)
+		counter.hist.Merge(other.counters[name].hist)
+		counter.failed += other.counters[name].failed
+	}
+}
+
+func (s *stepStats) summaries() []StepSummary {
+	var summaries []StepSummary
+	for _, name := range s.order {
+		counter := s.counters[name]
+		summaries = append(summaries, StepSummary{
+			Name:    name,
+			Count:   counter.hist.Count(),
+			Failed:  counter.failed,
+			Latency: counter.hist.Summary(),
+		})
+	}
+	return summaries
+}
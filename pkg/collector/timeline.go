@@ -0,0 +1,117 @@
+package collector
+
+import "time"
+
+const (
+	DefaultInterval = time.Second
+	// per-interval histograms only need a rough resolution
+	timelinePrecision = 2
+	// intervals older than this many intervals behind the newest one are
+	// finalized and their histogram is reused
+	timelineOpenIntervals = 2
+)
+
+// TimelinePoint aggregates the requests completed within one interval of a run.
+type TimelinePoint struct {
+	Offset      time.Duration `json:"offset"` // since the start of the run
+	Requests    int           `json:"requests"`
+	Errors      int           `json:"errors"`
+	Bytes       int64         `json:"bytes"`
+	MeanLatency time.Duration `json:"meanLatency"`
+	MaxLatency  time.Duration `json:"maxLatency"`
+	P50         time.Duration `json:"p50"`
+	P90         time.Duration `json:"p90"`
+	P99         time.Duration `json:"p99"`
+}
+
+// timeline buckets entries by the interval they completed in. Only the most
+// recent intervals keep a histogram, so memory stays bounded for long runs.
+type timeline struct {
+	start    time.Time
+	interval time.Duration
+	points   []TimelinePoint
+	sums     []time.Duration
+	open     map[int]*Histogram
+	spare    []*Histogram
+}
+
+func newTimeline(start time.Time, interval time.Duration) *timeline {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &timeline{
+		start:    start,
+		interval: interval,
+		open:     make(map[int]*Histogram),
+	}
+}
+
+func (t *timeline) add(end time.Time, latency time.Duration, failed bool, bytes int64) {
+	idx := 0
+	if end.After(t.start) {
+		idx = int(end.Sub(t.start) / t.interval)
+	}
+	for len(t.points) <= idx {
+		t.points = append(t.points, TimelinePoint{Offset: time.Duration(len(t.points)) * t.interval})
+		t.sums = append(t.sums, 0)
+	}
+	point := &t.points[idx]
+	point.Requests++
+	if failed {
+		point.Errors++
+	}
+	point.Bytes += bytes
+	t.sums[idx] += latency
+	if latency > point.MaxLatency {
+		point.MaxLatency = latency
+	}
+
+	if idx <= len(t.points)-1-timelineOpenIntervals {
+		// the interval is already finalized, a late entry only counts
+		// towards the totals
+		if _, ok := t.open[idx]; !ok {
+			return
+		}
+	}
+	hist, ok := t.open[idx]
+	if !ok {
+		hist = t.histogram()
+		t.open[idx] = hist
+	}
+	hist.Record(latency)
+	t.close(len(t.points) - 1 - timelineOpenIntervals)
+}
+
+func (t *timeline) histogram() *Histogram {
+	if n := len(t.spare); n > 0 {
+		hist := t.spare[n-1]
+		t.spare = t.spare[:n-1]
+		hist.Reset()
+		return hist
+	}
+	return NewHistogram(timelinePrecision)
+}
+
+// close finalizes every open interval up to and including idx.
+func (t *timeline) close(idx int) {
+	for i, hist := range t.open {
+		if i > idx {
+			continue
+		}
+		t.points[i].P50 = hist.ValueAtPercentile(50)
+		t.points[i].P90 = hist.ValueAtPercentile(90)
+		t.points[i].P99 = hist.ValueAtPercentile(99)
+		delete(t.open, i)
+		t.spare = append(t.spare, hist)
+	}
+}
+
+func (t *timeline) finish() []TimelinePoint {
+	t.close(len(t.points))
+	for i := range t.points {
+		if t.points[i].Requests > 0 {
+			t.points[i].MeanLatency = t.sums[i] / time.Duration(t.points[i].Requests)
+		}
+	}
+	return t.points
+}
@@ -0,0 +1,158 @@
+// Package netbench runs HTTP and SMTP benchmarks from Go code, e.g. to assert
+// on latencies inside integration tests. Nothing is printed, the statistics
+// are returned as a Result:
+//
+//	client := netbench.NewHTTP("http://localhost:8080/health")
+//	result, err := netbench.Run(ctx, client, netbench.Options{
+//		Concurency: 10,
+//		Duration:   5 * time.Second,
+//	})
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	if result.Stats.ResponseTime.P99 > 50*time.Millisecond {
+//		t.Errorf("p99 too high: %s", result.Stats.ResponseTime.P99)
+//	}
+package netbench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/BatikanHyt/netbench/pkg/collector"
+	"github.com/BatikanHyt/netbench/pkg/protocols"
+	"github.com/BatikanHyt/netbench/pkg/report"
+)
+
+type (
+	// HTTP configures the requests of an HTTP benchmark.
+	HTTP = protocols.HttpClient
+	// SMTP configures the mails of an SMTP benchmark.
+	SMTP = protocols.SmtpClient
+	// Stage is a step of a load profile.
+	Stage = protocols.Stage
+	// Result holds the statistics of a finished benchmark.
+	Result = report.Result
+)
+
+// Options configure the load of a benchmark. Zero values take the defaults
+// of the command line, a run without Duration or Stages sends TotalRequest
+// requests.
+type Options struct {
+	Concurency   int           // requests in flight, defaults to 1
+	TotalRequest int           // defaults to 1
+	Duration     time.Duration // length of the run, overrides TotalRequest
+	Rate         float64       // open-loop arrivals per second, 0 for closed-loop
+	Stages       []Stage
+	StageTarget  string        // workers or rate, defaults to workers
+	StageMode    string        // ramp or step, defaults to ramp
+	Timeout      time.Duration // deadline of every request, 0 for none
+	DrainTimeout time.Duration // time in-flight requests get once ctx is cancelled
+	Precision    int           // significant digits of the latency histograms
+	Interval     time.Duration // length of a timeline interval
+	RawLog       string        // file every request is logged to, empty for none
+	RawLogFormat string        // ndjson or binary, defaults to ndjson
+}
+
+// NewHTTP returns an HTTP benchmark sending GET requests to url.
+func NewHTTP(url string) *HTTP {
+	client := protocols.NewHttpClient()
+	client.Url = url
+	client.Keep_alive = true
+	return client
+}
+
+// NewSMTP returns an SMTP benchmark against the server at address, From, To
+// and Subject have to be set before running it.
+func NewSMTP(address string) *SMTP {
+	client := protocols.NewSmtpClient()
+	client.Address = address
+	return client
+}
+
+// Run benchmarks client, an *HTTP, an *SMTP or any protocol registered with
+// protocols.Register, with the load of opts.
+// An invalid client is reported as protocols.ConfigErrors before anything is
+// sent. Cancelling ctx stops the run, the result then covers the requests
+// done so far and has Interrupted set.
+func Run(ctx context.Context, client protocols.BaseProtocol, opts Options) (*Result, error) {
+	runner, err := newRunner(opts)
+	if err != nil {
+		return nil, err
+	}
+	def, ok := protocols.LookupProtocol(client)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported client %T", client)
+	}
+	if def.Validate != nil {
+		if errs := def.Validate(client); len(errs) > 0 {
+			return nil, protocols.ConfigErrors(errs)
+		}
+	}
+	if err := runner.SetProtocol(def.Name, client); err != nil {
+		return nil, err
+	}
+	return runner.RunContext(ctx)
+}
+
+func newRunner(opts Options) (*protocols.Runner, error) {
+	runner := &protocols.Runner{
+		Concurency:   opts.Concurency,
+		TotalRequest: opts.TotalRequest,
+		Duration:     opts.Duration.String(),
+		Rate:         opts.Rate,
+		Stages:       opts.Stages,
+		StageTarget:  opts.StageTarget,
+		StageMode:    opts.StageMode,
+		Timeout:      opts.Timeout.String(),
+		DrainTimeout: opts.DrainTimeout.String(),
+		Precision:    opts.Precision,
+		Interval:     opts.Interval.String(),
+		RawLog:       opts.RawLog,
+		RawLogFormat: opts.RawLogFormat,
+		Quiet:        true,
+	}
+	if runner.Concurency == 0 {
+		runner.Concurency = 1
+	}
+	if runner.TotalRequest == 0 {
+		runner.TotalRequest = 1
+	}
+	if runner.StageTarget == "" {
+		runner.StageTarget = protocols.StageTargetWorkers
+	}
+	if runner.StageMode == "" {
+		runner.StageMode = protocols.StageModeRamp
+	}
+	if opts.DrainTimeout == 0 {
+		runner.DrainTimeout = protocols.DefaultDrainTimeout.String()
+	}
+	if runner.Precision == 0 {
+		runner.Precision = collector.DefaultPrecision
+	}
+	if opts.Interval == 0 {
+		runner.Interval = collector.DefaultInterval.String()
+	}
+	if runner.RawLogFormat == "" {
+		runner.RawLogFormat = collector.RawLogNdjson
+	}
+
+	if runner.Concurency < 0 || runner.TotalRequest < 0 {
+		return nil, errors.New("Concurency and total request cannot be negative")
+	}
+	if opts.Duration < 0 || opts.Timeout < 0 || opts.DrainTimeout < 0 || opts.Interval < 0 {
+		return nil, errors.New("Durations cannot be negative")
+	}
+	if runner.Rate < 0 {
+		return nil, errors.New("Rate cannot be negative")
+	}
+	if runner.Precision < 1 || runner.Precision > 5 {
+		return nil, errors.New("Precision must be between 1 and 5")
+	}
+	if err := runner.ValidateStages(); err != nil {
+		return nil, err
+	}
+	return runner, nil
+}
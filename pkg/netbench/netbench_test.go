@@ -0,0 +1,128 @@
+package netbench
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/BatikanHyt/netbench/pkg/protocols"
+)
+
+// captureStdout returns what f prints to the standard output.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	printed := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		printed <- string(b)
+	}()
+	defer func() {
+		os.Stdout = stdout
+	}()
+	f()
+	w.Close()
+	return <-printed
+}
+
+func newServer(t *testing.T, delay time.Duration) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRun(t *testing.T) {
+	server := newServer(t, time.Millisecond)
+	var result *Result
+	var err error
+	printed := captureStdout(t, func() {
+		result, err = Run(context.Background(), NewHTTP(server.URL), Options{Concurency: 4, TotalRequest: 100})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if printed != "" {
+		t.Errorf("printed %q, want nothing", printed)
+	}
+	stats := result.Stats
+	if stats.TotalRequest != 100 || stats.SuccessfulReq != 100 {
+		t.Errorf("got %d requests, %d successful, want 100", stats.TotalRequest, stats.SuccessfulReq)
+	}
+	for name, latency := range map[string]time.Duration{
+		"service p50":  stats.ServiceTime.P50,
+		"service p99":  stats.ServiceTime.P99,
+		"response p50": stats.ResponseTime.P50,
+		"response p99": stats.ResponseTime.P99,
+	} {
+		if latency < time.Millisecond {
+			t.Errorf("%s = %s, want at least the delay of the server", name, latency)
+		}
+	}
+	if result.Interrupted {
+		t.Errorf("a finished run is marked as interrupted")
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	server := newServer(t, 10*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	result, err := Run(ctx, NewHTTP(server.URL), Options{Concurency: 2, Duration: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("run took %s after the context was cancelled", elapsed)
+	}
+	if !result.Interrupted {
+		t.Errorf("the run of a cancelled context is not marked as interrupted")
+	}
+	if result.Stats.TotalRequest == 0 {
+		t.Errorf("got no requests, want the ones done before the cancel")
+	}
+}
+
+func TestRunInvalidClient(t *testing.T) {
+	tests := []struct {
+		name   string
+		client protocols.BaseProtocol
+		paths  []string
+	}{
+		{"http url", NewHTTP("not a url"), []string{"url"}},
+		{"smtp mail", NewSMTP("127.0.0.1:2525"), []string{"from", "to", "subject"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Run(context.Background(), tt.client, Options{})
+			if result != nil {
+				t.Errorf("got a result for an invalid client")
+			}
+			var errs protocols.ConfigErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("got error %v, want ConfigErrors", err)
+			}
+			if len(errs) != len(tt.paths) {
+				t.Fatalf("got %d errors, want %d: %v", len(errs), len(tt.paths), errs)
+			}
+			for i, path := range tt.paths {
+				if errs[i].Path != path {
+					t.Errorf("error %d is at %s, want %s", i, errs[i].Path, path)
+				}
+			}
+		})
+	}
+}
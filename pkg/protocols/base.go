@@ -1,36 +1,89 @@
 package protocols
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/BatikanHyt/netbench/pkg/collector"
+	"github.com/BatikanHyt/netbench/pkg/helpers"
+	"github.com/BatikanHyt/netbench/pkg/report"
 )
 
-var protocolMap = map[string]func() BaseProtocol{
-	"http": func() BaseProtocol { return NewHttpClient() },
-	"smtp": func() BaseProtocol { return NewSmtpClient() },
+// Iteration describes a single StartBenchmark call issued by the Runner.
+type Iteration struct {
+	Worker    int           // slot of the concurency pool or stage worker running the call
+	Seq       int64         // number of the call within the run, starting from 0
+	Scheduled time.Time     // intended send time, latency is corrected against it; closed-loop calls are scheduled as they start
+	Timeout   time.Duration // deadline of the call, 0 when only the run bounds it
+	Workers   int           // number of workers of the run, Worker is below it
+	stop      context.CancelFunc
 }
 
-var statMap = map[string]func() collector.StatBase{
-	"http": func() collector.StatBase { return collector.CreateHttpStatCollector() },
-	"smtp": func() collector.StatBase { return collector.CreateSmtpStatCollector() },
+// Stop ends the run once the calls in flight are done, e.g. when the data a
+// protocol sends runs out. The statistics are complete, unlike those of an
+// interrupted run.
+func (iter Iteration) Stop() {
+	if iter.stop != nil {
+		iter.stop()
+	}
+}
+
+// context derives the context of a single call from the run context ctx.
+func (iter Iteration) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if iter.Timeout > 0 {
+		return context.WithTimeout(ctx, iter.Timeout)
+	}
+	return context.WithCancel(ctx)
 }
 
+// BaseProtocol is implemented by every protocol client. StartBenchmark gets
+// the context of the run, it is cancelled when the run ends so that the call
+// has to return and report itself as cancelled.
 type BaseProtocol interface {
-	StartBenchmark()
-	Initialize(collectorBase *collector.StatBase)
+	StartBenchmark(ctx context.Context, iter Iteration)
+	// Initialize prepares the protocol to report its entries to stat
+	Initialize(stat collector.StatBase) error
+}
+
+// describer is implemented by protocols that tell what they benchmark.
+type describer interface {
+	Describe() string
 }
 
 type Runner struct {
-	Concurency    int    `json:"concurency"`
-	TotalRequest  int    `json:"totalRequest"`
-	Duration      string `json:"duration"`
-	OutputFormat  string `json:"output"`
+	Concurency   int     `json:"concurency"`
+	TotalRequest int     `json:"totalRequest"`
+	Duration     string  `json:"duration"`
+	Rate         float64 `json:"rate"`
+	Precision    int     `json:"precision"`
+	Interval     string  `json:"interval"`
+	Stages       []Stage `json:"stages"`
+	StageTarget  string  `json:"stageTarget"`
+	StageMode    string  `json:"stageMode"`
+	OutputFormat string  `json:"output"`
+	OutputFile   string  `json:"outputFile"`
+	RawLog       string  `json:"rawLog"`
+	RawLogFormat string  `json:"rawLogFormat"`
+	DrainTimeout string  `json:"drainTimeout"`
+	Timeout      string  `json:"timeout"` // per request, 0s for none
+	// scenarios run in parallel instead of a single protocol
+	Scenarios     []*Scenario `json:"scenarios"`
 	Protocol      BaseProtocol
 	StatCollector collector.StatBase
+	ProtocolName  string
+	Dropped       int64 // open-loop arrivals still waiting for a free worker when the run ended
+	Interrupted   bool  // the run was stopped by a signal, the results are partial
+	Quiet         bool  // nothing is printed, e.g. when embedded in tests
+	seq           int64
+	stop          context.CancelFunc // ends the current run, see Iteration.Stop
 }
 
 const (
@@ -38,22 +91,198 @@ const (
 	progressRequestThreshhold = 100
 )
 
+// SetProtocol makes protocol, registered under name, the protocol of the run.
+func (r *Runner) SetProtocol(name string, protocol BaseProtocol) error {
+	def, ok := Lookup(name)
+	if !ok {
+		return fmt.Errorf("unsupported protocol: %s", name)
+	}
+	r.Protocol = protocol
+	r.ProtocolName = name
+	r.StatCollector = def.NewCollector()
+	return nil
+}
+
+// Run runs the benchmark from the command line, an interrupt stops it with
+// partial results. The results are printed and written to the output file.
 func (r *Runner) Run() {
-	if r.Protocol == nil {
+	if len(r.Scenarios) == 0 && (r.Protocol == nil || r.StatCollector == nil) {
 		return
 	}
-	if r.StatCollector == nil {
+	ctx, release := trapInterrupt()
+	defer release()
+	if _, err := r.RunContext(ctx); err != nil {
+		fmt.Printf("Error: %s\n", err)
 		return
 	}
+	r.finish()
+}
+
+// RunContext runs the benchmark and returns its result, cancelling ctx stops
+// the run like an interrupt does. Nothing is printed when Quiet is set.
+func (r *Runner) RunContext(ctx context.Context) (*report.Result, error) {
+	if len(r.Scenarios) > 0 {
+		if err := r.executeScenarios(ctx); err != nil {
+			return nil, err
+		}
+		return r.Result(), nil
+	}
+	if r.Protocol == nil || r.StatCollector == nil {
+		return nil, errors.New("No protocol to benchmark")
+	}
+	if err := r.execute(ctx); err != nil {
+		return nil, err
+	}
+	return r.Result(), nil
+}
+
+// printProgress prints the statistics collected so far.
+func (r *Runner) printProgress() {
+	if !r.Quiet {
+		r.StatCollector.PrintProgressStats()
+	}
+}
+
+// finish prints the final result and writes the configured output file.
+func (r *Runner) finish() {
+	if len(r.Scenarios) > 0 {
+		r.printScenarios()
+	}
+	r.printFinalResult()
+	if r.OutputFormat != "" {
+		if err := report.WriteFile(r.OutputFormat, r.OutputFile, r.Result()); err != nil {
+			fmt.Printf("Error writing results: %s\n", err)
+		}
+	}
+}
+
+// Result collects the statistics of a finished run for the result writers.
+func (r *Runner) Result() *report.Result {
+	globalStats := r.StatCollector.GetGlobalStats()
+	result := &report.Result{
+		Protocol:     r.ProtocolName,
+		Concurency:   r.Concurency,
+		TotalRequest: r.TotalRequest,
+		Duration:     r.Duration,
+		Rate:         r.Rate,
+		Dropped:      r.Dropped,
+		Interrupted:  r.Interrupted,
+		Stats:        *globalStats,
+		Status:       r.StatCollector.GetResponseStatus(),
+	}
+	if globalStats.TotalDuration > 0 {
+		result.RequestsPerSec = float64(globalStats.TotalRequest) / globalStats.TotalDuration.Seconds()
+	}
+	if len(r.Scenarios) > 0 {
+		result.Concurency, result.Rate = 0, 0
+	}
+	for _, scenario := range r.Scenarios {
+		scenarioResult := scenario.Runner.Result()
+		scenarioResult.Name = scenario.Name
+		result.Concurency += scenarioResult.Concurency
+		result.Rate += scenarioResult.Rate
+		result.Scenarios = append(result.Scenarios, scenarioResult)
+	}
+	return result
+}
+
+// newWorkerPool returns a pool of worker ids, taking an id acquires one of the
+// size slots and putting it back releases it.
+func newWorkerPool(size int) chan int {
+	pool := make(chan int, size)
+	for i := 0; i < size; i++ {
+		pool <- i
+	}
+	return pool
+}
+
+// nextIteration returns the next call of the run.
+func (r *Runner) nextIteration(worker int, scheduled time.Time) Iteration {
+	timeout, _ := time.ParseDuration(r.Timeout)
+	return Iteration{
+		Worker:    worker,
+		Seq:       atomic.AddInt64(&r.seq, 1) - 1,
+		Scheduled: scheduled,
+		Timeout:   timeout,
+		Workers:   r.workers(),
+		stop:      r.stop,
+	}
+}
+
+// workers returns the number of workers of the run.
+func (r *Runner) workers() int {
+	if len(r.Stages) == 0 || r.StageTarget == StageTargetRate {
+		return r.Concurency
+	}
+	workers := 0
+	for _, stage := range r.Stages {
+		if target := int(math.Round(stage.Target)); target > workers {
+			workers = target
+		}
+	}
+	return workers
+}
+
+// runContext returns the context handed to the calls. A run bounded by time
+// ends exactly at its deadline, cancelling the calls still in flight.
+func (r *Runner) runContext(start time.Time) (context.Context, context.CancelFunc) {
+	var length time.Duration
+	if len(r.Stages) > 0 {
+		length = r.stagesDuration()
+	} else {
+		length, _ = time.ParseDuration(r.Duration)
+	}
+	if length > 0 {
+		return context.WithDeadline(context.Background(), start.Add(length))
+	}
+	return context.WithCancel(context.Background())
+}
+
+// execute runs the benchmark until the configured load is sent and every
+// entry is consumed by the collector. Once ctx is done no more requests are
+// started and the in-flight ones are drained.
+func (r *Runner) execute(ctx context.Context) error {
+	// the loops below stop starting requests on an interrupt or once a call
+	// stops the run, only an interrupt cuts the drain short
+	stopCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	r.stop = stop
 	var wg sync.WaitGroup
 	var cwg sync.WaitGroup
-	r.Protocol.Initialize(&r.StatCollector)
-	pool := make(chan struct{}, r.Concurency)
+	if err := r.Protocol.Initialize(r.StatCollector); err != nil {
+		return err
+	}
+	if d, ok := r.Protocol.(describer); ok && !r.Quiet {
+		fmt.Printf("Running %s\n", d.Describe())
+	}
+	interval, _ := time.ParseDuration(r.Interval)
+	options := collector.Options{Precision: r.Precision, Interval: interval, Start: time.Now()}
+	if r.RawLog != "" {
+		rawLog, err := collector.CreateRawLog(r.RawLog, r.RawLogFormat, collector.RawLogHeader{
+			Protocol:   r.ProtocolName,
+			Start:      options.Start,
+			Concurency: r.Concurency,
+			Rate:       r.Rate,
+		})
+		if err != nil {
+			return fmt.Errorf("Unable to create raw log: %s", err)
+		}
+		options.RawLog = rawLog
+		defer rawLog.Close()
+	}
+	r.StatCollector.SetOptions(options)
+	r.seq = 0
+	runCtx, cancel := r.runContext(options.Start)
+	defer cancel()
+	pool := newWorkerPool(r.Concurency)
 	cwg.Add(1)
 	go r.StatCollector.Consume(&cwg)
-	if r.Duration != "0s" {
+	if len(r.Stages) > 0 {
+		r.runStages(stopCtx, runCtx, &wg, pool)
+	} else if r.Rate > 0 {
+		r.runOpenLoop(stopCtx, runCtx, &wg, pool)
+	} else if r.Duration != "0s" {
 		duration, _ := time.ParseDuration(r.Duration)
-		timeout := time.After(duration)
 		dur2 := progressTimeThreshold
 		var progress_stats <-chan time.Time
 		if duration > dur2 {
@@ -63,97 +292,229 @@ func (r *Runner) Run() {
 		for {
 			select {
 			case <-progress_stats:
-				r.StatCollector.PrintProgressStats()
-			case <-timeout:
+				r.printProgress()
+			case <-runCtx.Done():
 				// timeout has been hit, break out of the loop
 				break loop
-			case pool <- struct{}{}:
-				// acquire a token from the pool
+			case <-stopCtx.Done():
+				break loop
+			case worker := <-pool:
+				// acquired a token from the pool
 				wg.Add(1)
+				iter := r.nextIteration(worker, time.Now())
 				go func() {
 					defer func() {
 						// release the token
-						<-pool
+						pool <- worker
 						wg.Done()
 					}()
-					r.Protocol.StartBenchmark()
+					r.Protocol.StartBenchmark(runCtx, iter)
 				}()
 			}
 		}
 	} else {
-		wg.Add(r.TotalRequest)
-		current_progress := 0
+		// counted by the calls as they finish, every tenth of the requests
+		// prints the progress
+		var current_progress int64
+		progressStep := int64(r.TotalRequest / 10)
 		printProgress := false
 		if r.TotalRequest > progressRequestThreshhold {
 			printProgress = true
 		}
+	requests:
 		for i := 0; i < r.TotalRequest; i++ {
 			// acquire a token from the pool
-			pool <- struct{}{}
+			var worker int
+			select {
+			case worker = <-pool:
+			case <-stopCtx.Done():
+				break requests
+			}
+			wg.Add(1)
+			iter := r.nextIteration(worker, time.Now())
 			go func() {
 				defer func() {
-					if printProgress && current_progress >= r.TotalRequest/10 {
-						current_progress = 0
-						r.StatCollector.PrintProgressStats()
+					if printProgress && atomic.AddInt64(&current_progress, 1)%progressStep == 0 {
+						r.printProgress()
 					}
-					current_progress++
 					// release the token
-					<-pool
+					pool <- iter.Worker
 					wg.Done()
 				}()
-				r.Protocol.StartBenchmark()
+				r.Protocol.StartBenchmark(runCtx, iter)
 			}()
 		}
 	}
-	wg.Wait()
+	r.drain(ctx, &wg, cancel)
 	r.StatCollector.Finished()
 	cwg.Wait()
-	r.printFinalResult()
+	if options.RawLog != nil {
+		options.RawLog.WriteTrailer(collector.RawLogTrailer{
+			Dropped:     atomic.LoadInt64(&r.Dropped),
+			Interrupted: r.Interrupted,
+		})
+	}
+	return nil
 }
 
 func (r *Runner) printFinalResult() {
 	globalStats := r.StatCollector.GetGlobalStats()
 	req_per_sec := float64(globalStats.TotalRequest) / globalStats.TotalDuration.Seconds()
 	fmt.Printf("\nTotal Request: %d, Total Duration: %s, Total recv/send bytes: %d\n"+
-		"Succesfull requests: %d, Failed Requests %d Avg Response time:%s \nReq/sec:%f\nThroughput: %f MB/s\n",
+		"Succesfull requests: %d, Failed Requests %d Avg Service time:%s Avg Response time:%s \nReq/sec:%f\nThroughput: %f MB/s\n",
 		globalStats.TotalRequest, globalStats.TotalDuration, globalStats.TotalSize,
-		globalStats.SuccessfulReq, globalStats.FailedReq, globalStats.AverageDuration, req_per_sec, globalStats.Throughput)
+		globalStats.SuccessfulReq, globalStats.FailedReq, globalStats.AverageDuration, globalStats.AverageResponseTime,
+		req_per_sec, globalStats.Throughput)
+	fmt.Printf("Wire recv/send bytes: %d/%d, Body recv/send bytes: %d/%d\n",
+		globalStats.ReadSize, globalStats.WriteSize, globalStats.BodyReadSize, globalStats.BodyWriteSize)
+	if globalStats.Cancelled > 0 {
+		fmt.Printf("Cancelled in-flight requests: %d\n", globalStats.Cancelled)
+	}
+	if r.Interrupted {
+		fmt.Printf("Run was interrupted, the results are partial\n")
+	}
+	if len(r.Stages) > 0 {
+		fmt.Printf("Stages: %d, Total stage duration: %s, Dropped arrivals: %d\n", len(r.Stages), r.stagesDuration(), r.Dropped)
+	} else if r.Rate > 0 {
+		fmt.Printf("Target rate: %.2f req/s, Dropped arrivals: %d\n", r.Rate, r.Dropped)
+	}
+	printLatency("Service time", globalStats.ServiceTime)
+	printLatency("Response time", globalStats.ResponseTime)
+	printPhases(globalStats)
+	printSteps(globalStats.Steps)
+	printErrors(globalStats.Errors)
+}
 
+func printErrors(errors []collector.ErrorSummary) {
+	if len(errors) > 0 {
+		fmt.Printf("Errors:\n")
+	}
+	for _, e := range errors {
+		fmt.Printf("  %s in %s: %d\n", e.Kind, e.Phase, e.Count)
+		for _, sample := range e.Samples {
+			fmt.Printf("    (%d) %s\n", sample.Count, sample.Message)
+		}
+	}
 }
 
+func printSteps(steps []collector.StepSummary) {
+	if len(steps) > 0 {
+		fmt.Printf("Steps failed/mean/p50/p90/p99/max:\n")
+	}
+	for _, step := range steps {
+		l := step.Latency
+		fmt.Printf("  %-12s (%d) %d/%s/%s/%s/%s/%s\n", step.Name, step.Count, step.Failed, l.Mean, l.P50, l.P90, l.P99, l.Max)
+	}
+}
+
+func printPhases(s *collector.GlobalStatistic) {
+	if len(s.Phases) > 0 {
+		fmt.Printf("Phases mean/p50/p90/p99/max:\n")
+	}
+	for _, phase := range s.Phases {
+		l := phase.Latency
+		fmt.Printf("  %-8s (%d) %s/%s/%s/%s/%s\n", phase.Name, phase.Count, l.Mean, l.P50, l.P90, l.P99, l.Max)
+	}
+	keys := make([]string, 0, len(s.Labels))
+	for key := range s.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		values := make([]string, 0, len(s.Labels[key]))
+		for value, count := range s.Labels[key] {
+			values = append(values, fmt.Sprintf("%s:%d", value, count))
+		}
+		sort.Strings(values)
+		fmt.Printf("%s: %s\n", key, strings.Join(values, ", "))
+	}
+}
+
+func printLatency(name string, s collector.LatencySummary) {
+	fmt.Printf("%s min/mean/stddev/max: %s/%s/%s/%s\n", name, s.Min, s.Mean, s.StdDev, s.Max)
+	fmt.Printf("  p50:%s p75:%s p90:%s p95:%s p99:%s p99.9:%s p99.99:%s\n",
+		s.P50, s.P75, s.P90, s.P95, s.P99, s.P999, s.P9999)
+
+}
+
+// UnmarshalJSON validates a config and decodes it into the runner, the error
+// is a ConfigErrors listing every problem of the config.
 func (r *Runner) UnmarshalJSON(data []byte) error {
 	var v map[string]interface{}
 	if err := json.Unmarshal(data, &v); err != nil {
 		return err
 	}
+	if errs := validateRunner(v); len(errs) > 0 {
+		return errs
+	}
+	return r.decode(v)
+}
+
+// decode sets the runner from a validated config.
+func (r *Runner) decode(v map[string]interface{}) error {
+	var scenarios interface{}
 
 	for key, value := range v {
+		if value == nil {
+			// null keeps the default
+			continue
+		}
 		if key == "concurency" {
 			r.Concurency = int(value.(float64))
 		} else if key == "totalRequest" {
 			r.TotalRequest = int(value.(float64))
 		} else if key == "duration" {
 			r.Duration = value.(string)
+		} else if key == "rate" {
+			r.Rate = value.(float64)
+		} else if key == "precision" {
+			r.Precision = int(value.(float64))
+		} else if key == "interval" {
+			r.Interval = value.(string)
+		} else if key == "rawLog" {
+			r.RawLog = value.(string)
+		} else if key == "rawLogFormat" {
+			r.RawLogFormat = value.(string)
+		} else if key == "stages" {
+			stageJson, _ := json.Marshal(value)
+			if err := json.Unmarshal(stageJson, &r.Stages); err != nil {
+				return err
+			}
+		} else if key == "stageTarget" {
+			r.StageTarget = value.(string)
+		} else if key == "stageMode" {
+			r.StageMode = value.(string)
 		} else if key == "output" {
 			r.OutputFormat = value.(string)
+		} else if key == "outputFile" {
+			r.OutputFile = value.(string)
+		} else if key == "timeout" {
+			r.Timeout = value.(string)
+		} else if key == "drainTimeout" {
+			r.DrainTimeout = value.(string)
+		} else if key == "scenarios" {
+			// decoded once the settings they inherit are known
+			scenarios = value
+		} else if helpers.Contains(scenarioOnlyKeys, key) {
+			// set on the scenario by decodeScenarios
 		} else {
-			createFunc, ok := protocolMap[key]
+			def, ok := Lookup(key)
 			if !ok {
 				return fmt.Errorf("unsupported protocol: %s", key)
 			}
-			protoVal, ok := value.(map[string]interface{})
-			if !ok {
-				return fmt.Errorf("unsupported protocol: %s", key)
+			protocolValue := def.New()
+			if err := decodeProtocol(protocolValue, value.(map[string]interface{})); err != nil {
+				return err
 			}
-			protoJson, _ := json.Marshal(protoVal)
-			protocolValue := createFunc()
-			if err := json.Unmarshal(protoJson, protocolValue); err != nil {
+			if err := r.SetProtocol(key, protocolValue); err != nil {
 				return err
 			}
-			r.Protocol = protocolValue
-			stat_funct := statMap[key]
-			r.StatCollector = stat_funct()
 		}
 	}
-	return nil
+	if scenarios != nil {
+		if err := r.decodeScenarios(scenarios); err != nil {
+			return err
+		}
+	}
+	return r.ValidateStages()
 }
@@ -0,0 +1,228 @@
+package protocols
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFormats are the formats a config file can be written in, picked by
+// the extension of the file. Files with any other extension are read as JSON.
+var ConfigFormats = []string{"json", "yaml", "toml"}
+
+// envReference matches ${VAR} and ${VAR:-default}, $${ escapes a reference.
+var envReference = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// ReadConfig reads a JSON, YAML or TOML config file and returns it as JSON,
+// ready for the Runner. References to environment variables in string
+// values, ${VAR} or ${VAR:-default}, are replaced by their value so secrets
+// can stay out of the file. The default is used when the variable is unset
+// or empty, a reference to an unset variable without a default is an error.
+func ReadConfig(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("Invalid YAML: %s", err)
+		}
+	case ".toml":
+		if err := toml.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("Invalid TOML: %s", err)
+		}
+	default:
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("Invalid JSON: %s", err)
+		}
+	}
+	var errs ConfigErrors
+	interpolate("$", config, &errs)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return json.Marshal(config)
+}
+
+// interpolate replaces the environment references in the string values below
+// value and returns it.
+func interpolate(path string, value interface{}, errs *ConfigErrors) interface{} {
+	switch v := value.(type) {
+	case string:
+		return interpolateString(path, v, errs)
+	case map[string]interface{}:
+		for _, key := range sortedConfigKeys(v) {
+			v[key] = interpolate(path+"."+key, v[key], errs)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = interpolate(fmt.Sprintf("%s[%d]", path, i), item, errs)
+		}
+	case []map[string]interface{}:
+		// arrays of tables in TOML
+		for i, item := range v {
+			interpolate(fmt.Sprintf("%s[%d]", path, i), item, errs)
+		}
+	}
+	return value
+}
+
+func interpolateString(path string, s string, errs *ConfigErrors) string {
+	return envReference.ReplaceAllStringFunc(s, func(match string) string {
+		if match == "$${" {
+			return "${"
+		}
+		groups := envReference.FindStringSubmatch(match)
+		name, hasDefault := groups[1], strings.Contains(match, ":-")
+		value, set := os.LookupEnv(name)
+		// like in the shell a default also replaces an empty value
+		if hasDefault && value == "" {
+			return groups[2]
+		}
+		if set {
+			return value
+		}
+		*errs = append(*errs, ConfigError{Path: path, Message: fmt.Sprintf("Environment variable %s is not set", name)})
+		return ""
+	})
+}
+
+// Config returns the settings of the runner in the layout of a config file,
+// e.g. to show the effective config once flags and environment variables
+// are applied. Header values and secrets such as passwords or tokens are
+// masked.
+func (r *Runner) Config() map[string]interface{} {
+	config := map[string]interface{}{
+		"concurency":   r.Concurency,
+		"totalRequest": r.TotalRequest,
+		"duration":     r.Duration,
+		"rate":         r.Rate,
+		"precision":    r.Precision,
+		"interval":     r.Interval,
+		"stageTarget":  r.StageTarget,
+		"stageMode":    r.StageMode,
+		"rawLogFormat": r.RawLogFormat,
+		"timeout":      r.Timeout,
+		"drainTimeout": r.DrainTimeout,
+	}
+	if len(r.Stages) > 0 {
+		config["stages"] = r.Stages
+	}
+	if r.RawLog != "" {
+		config["rawLog"] = r.RawLog
+	}
+	if r.OutputFormat != "" {
+		config["output"] = r.OutputFormat
+		config["outputFile"] = r.OutputFile
+	}
+	if r.Protocol != nil {
+		config[r.ProtocolName] = protocolConfig(r.Protocol)
+	}
+	if len(r.Scenarios) > 0 {
+		scenarios := make([]interface{}, 0, len(r.Scenarios))
+		for _, scenario := range r.Scenarios {
+			scenarioConfig := scenario.Runner.Config()
+			scenarioConfig["name"] = scenario.Name
+			scenarioConfig["startAfter"] = scenario.StartAfter
+			scenarios = append(scenarios, scenarioConfig)
+		}
+		config["scenarios"] = scenarios
+	}
+	return config
+}
+
+// durations of a protocol block are given in seconds in a config
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// decodeProtocol decodes a protocol block of a config into protocol.
+func decodeProtocol(protocol BaseProtocol, block map[string]interface{}) error {
+	t := reflect.TypeOf(protocol)
+	if t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct {
+		converted := make(map[string]interface{}, len(block))
+		for key, value := range block {
+			converted[key] = value
+			if field, ok := configField(t.Elem(), key); ok && field.Type == durationType {
+				if n, ok := value.(float64); ok {
+					converted[key] = int64(n * float64(time.Second))
+				}
+			}
+		}
+		block = converted
+	}
+	data, _ := json.Marshal(block)
+	return json.Unmarshal(data, protocol)
+}
+
+// protocolConfig returns the config keys of a protocol and their values.
+func protocolConfig(protocol BaseProtocol) map[string]interface{} {
+	block := make(map[string]interface{})
+	t := reflect.TypeOf(protocol)
+	if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return block
+	}
+	data, err := json.Marshal(protocol)
+	if err != nil {
+		return block
+	}
+	var values map[string]interface{}
+	json.Unmarshal(data, &values)
+	for _, name := range configFieldNames(t.Elem()) {
+		block[name] = values[name]
+		if field, _ := configField(t.Elem(), name); field.Type == durationType {
+			if n, ok := values[name].(float64); ok {
+				block[name] = n / float64(time.Second)
+			}
+		}
+	}
+	maskSecrets(block, false)
+	return block
+}
+
+// keys whose values are masked, matched case-insensitively anywhere in the key
+var secretKeys = []string{"password", "token", "secret", "authorization"}
+
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, secret := range secretKeys {
+		if strings.Contains(key, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// maskSecrets masks the non-empty strings of v under a secret key, or all of
+// them when all is set, e.g. the values of headers which may hold cookies or
+// credentials.
+func maskSecrets(v interface{}, all bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if s, ok := value.(string); ok {
+				if s != "" && (all || isSecretKey(key)) {
+					v[key] = "******"
+				}
+				continue
+			}
+			maskSecrets(value, all || strings.EqualFold(key, "headers") || isSecretKey(key))
+		}
+	case []interface{}:
+		for i, value := range v {
+			if s, ok := value.(string); ok && s != "" && all {
+				v[i] = "******"
+				continue
+			}
+			maskSecrets(value, all)
+		}
+	}
+}
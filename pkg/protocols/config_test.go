@@ -0,0 +1,89 @@
+package protocols
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInterpolateString(t *testing.T) {
+	t.Setenv("NETBENCH_TEST_SET", "secret")
+	t.Setenv("NETBENCH_TEST_EMPTY", "")
+	tests := []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{"${NETBENCH_TEST_SET}", "secret", false},
+		{"pw=${NETBENCH_TEST_SET}!", "pw=secret!", false},
+		{"${NETBENCH_TEST_EMPTY}", "", false},
+		{"${NETBENCH_TEST_UNSET}", "", true},
+		{"${NETBENCH_TEST_UNSET:-fallback}", "fallback", false},
+		{"${NETBENCH_TEST_EMPTY:-fallback}", "fallback", false},
+		{"${NETBENCH_TEST_SET:-fallback}", "secret", false},
+		{"$${NETBENCH_TEST_SET}", "${NETBENCH_TEST_SET}", false},
+	}
+	for _, tt := range tests {
+		var errs ConfigErrors
+		got := interpolateString("$.password", tt.in, &errs)
+		if got != tt.want {
+			t.Errorf("interpolateString(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if (len(errs) > 0) != tt.err {
+			t.Errorf("interpolateString(%q) errors %v, want error %v", tt.in, errs, tt.err)
+		}
+	}
+}
+
+func TestProtocolConfigMasksSecrets(t *testing.T) {
+	client := NewHttpClient()
+	client.Url = "http://127.0.0.1/"
+	client.Headers = map[string]string{"Authorization": "Bearer abc", "Cookie": "session=s1"}
+	client.Vars = map[string]string{"apiToken": "t1", "user": "alice"}
+	client.Steps = []HttpStep{{Name: "login", Url: "/login", Headers: map[string]string{"X-Csrf": "c1"}}}
+	client.Auth.Username = "alice"
+	client.Auth.Password = "pw"
+	config := protocolConfig(client)
+
+	value := func(m interface{}, key string) interface{} {
+		return m.(map[string]interface{})[key]
+	}
+	headers := config["headers"]
+	vars := config["vars"]
+	step := config["steps"].([]interface{})[0]
+	tests := []struct {
+		name string
+		got  interface{}
+		want string
+	}{
+		{"authorization header", value(headers, "Authorization"), "******"},
+		{"cookie header", value(headers, "Cookie"), "******"},
+		{"step header", value(value(step, "headers"), "X-Csrf"), "******"},
+		{"token var", value(vars, "apiToken"), "******"},
+		{"other var", value(vars, "user"), "alice"},
+		{"password", value(config["auth"], "password"), "******"},
+		{"username", value(config["auth"], "username"), "alice"},
+		{"url", config["url"], "http://127.0.0.1/"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s is %v, want %s", tt.name, tt.got, tt.want)
+		}
+	}
+	if client.Headers["Authorization"] != "Bearer abc" {
+		t.Errorf("masking changed the headers of the client")
+	}
+}
+
+func TestProtocolTimeoutSeconds(t *testing.T) {
+	var runner Runner
+	if err := runner.UnmarshalJSON([]byte(`{"http": {"url": "http://127.0.0.1/", "timeout": 2.5}}`)); err != nil {
+		t.Fatal(err)
+	}
+	client := runner.Protocol.(*HttpClient)
+	if client.Timeout != 2500*time.Millisecond {
+		t.Errorf("timeout 2.5 decoded to %s, want 2.5s", client.Timeout)
+	}
+	if got := protocolConfig(client)["Timeout"]; got != 2.5 {
+		t.Errorf("config has timeout %v, want 2.5", got)
+	}
+}
@@ -2,30 +2,33 @@ package protocols
 
 import (
 	"context"
+	"io"
 	"net"
+	"sync"
+	"sync/atomic"
 )
 
+// trackingConn counts the bytes read from and written to a single connection.
+// The counters are updated atomically so that a request can sample them while
+// the transport is using the connection.
 type trackingConn struct {
 	net.Conn
-	readSize  *int64
-	writeSize *int64
+	readSize     int64
+	writeSize    int64
+	claimLock    sync.Mutex
+	claimedRead  int64
+	claimedWrite int64
 }
 
 func (c *trackingConn) Read(b []byte) (int, error) {
 	n, err := c.Conn.Read(b)
-	if err == nil {
-		*c.readSize += int64(n)
-	}
-
+	atomic.AddInt64(&c.readSize, int64(n))
 	return n, err
 }
 
 func (c *trackingConn) Write(b []byte) (int, error) {
 	n, err := c.Conn.Write(b)
-	if err == nil {
-		*c.writeSize += int64(n)
-	}
-
+	atomic.AddInt64(&c.writeSize, int64(n))
 	return n, err
 }
 
@@ -34,16 +37,83 @@ func (c *trackingConn) Close() error {
 	return c.Conn.Close()
 }
 
-func DialContextWithBytesTracked(ctx context.Context, network, address string, readBytes, writeBytes *int64) (net.Conn, error) {
+// counters returns the bytes read and written on the connection so far.
+func (c *trackingConn) counters() (int64, int64) {
+	return atomic.LoadInt64(&c.readSize), atomic.LoadInt64(&c.writeSize)
+}
+
+// claim returns the bytes moved on the connection since the previous claim.
+// Every request claims once it is done, so the claims add up to the bytes of
+// the connection even when HTTP/2 multiplexes requests on it. A request is
+// then charged with what moved since the previous one finished rather than
+// with its own frames. The first request of a connection carries its
+// handshake.
+func (c *trackingConn) claim() (int64, int64) {
+	c.claimLock.Lock()
+	defer c.claimLock.Unlock()
+	read, write := c.counters()
+	read, c.claimedRead = read-c.claimedRead, read
+	write, c.claimedWrite = write-c.claimedWrite, write
+	return read, write
+}
+
+func DialContextWithBytesTracked(ctx context.Context, network, address string) (net.Conn, error) {
 	conn, err := (&net.Dialer{}).DialContext(ctx, network, address)
 	if err != nil {
 		return nil, err
 	}
 
 	// Wrap the connection with a tracking Conn
-	return &trackingConn{
-		Conn:      conn,
-		readSize:  readBytes,
-		writeSize: writeBytes,
-	}, nil
+	return &trackingConn{Conn: conn}, nil
+}
+
+// trackedConn finds the trackingConn below conn, unwrapping TLS connections.
+func trackedConn(conn net.Conn) *trackingConn {
+	for conn != nil {
+		switch c := conn.(type) {
+		case *trackingConn:
+			return c
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// byteCounter charges a single request with the bytes of the connection it
+// got, see trackingConn.claim. A request samples it once.
+type byteCounter struct {
+	conn *trackingConn
+}
+
+func (b *byteCounter) mark(conn net.Conn) {
+	b.conn = trackedConn(conn)
+}
+
+func (b *byteCounter) sample() (int64, int64) {
+	if b.conn == nil {
+		return 0, 0
+	}
+	return b.conn.claim()
+}
+
+// countingReader counts the payload bytes read from a request body.
+type countingReader struct {
+	io.Reader
+	read int64
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	atomic.AddInt64(&r.read, int64(n))
+	return n, err
+}
+
+func (r *countingReader) size() int64 {
+	if r == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&r.read)
 }
@@ -0,0 +1,67 @@
+package protocols
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"syscall"
+
+	"github.com/BatikanHyt/netbench/pkg/collector"
+)
+
+// classifyError turns the error of a request into a RequestError, phase is
+// the step of the request that failed. Errors after the run context ctx is
+// done are cancellations by the runner rather than failures of the server.
+func classifyError(ctx context.Context, err error, phase string) *collector.RequestError {
+	kind := collector.ErrorCancelled
+	if ctx.Err() == nil {
+		kind = errorKind(err, phase)
+	}
+	return &collector.RequestError{
+		Kind:    kind,
+		Phase:   phase,
+		Message: err.Error(),
+	}
+}
+
+func errorKind(err error, phase string) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var smtpErr *textproto.Error
+	var protoErr textproto.ProtocolError
+	var recordErr tls.RecordHeaderError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	switch {
+	case errors.As(err, &smtpErr):
+		if smtpErr.Code >= 500 {
+			return collector.ErrorPermanent
+		}
+		return collector.ErrorTransient
+	case errors.As(err, &dnsErr):
+		return collector.ErrorDns
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return collector.ErrorTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return collector.ErrorRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return collector.ErrorReset
+	case errors.As(err, &recordErr), errors.As(err, &authorityErr),
+		errors.As(err, &hostnameErr), errors.As(err, &invalidErr),
+		phase == "tls", phase == "starttls":
+		return collector.ErrorTls
+	case errors.As(err, &protoErr), strings.Contains(err.Error(), "malformed"):
+		return collector.ErrorProtocol
+	case phase == "transfer":
+		return collector.ErrorBodyRead
+	}
+	return collector.ErrorOther
+}
@@ -0,0 +1,236 @@
+package protocols
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BatikanHyt/netbench/pkg/helpers"
+	"github.com/spf13/pflag"
+)
+
+const (
+	FeederSequential = "sequential" // rows in file order, shared by the workers
+	FeederRandom     = "random"     // rows in a shuffled order, shuffled again on wrap
+	FeederPartition  = "partition"  // every worker takes its own rows, worker w the rows w, w+n, ...
+	FeederWrap       = "wrap"       // start over once the rows are used
+	FeederStop       = "stop"       // end the run once the rows are used
+)
+
+var ValidFeederModes = []string{FeederSequential, FeederRandom, FeederPartition}
+var ValidFeederEnds = []string{FeederWrap, FeederStop}
+var FeederFormats = []string{"csv", "jsonl"}
+
+// Feeder supplies the variables of the requests from the rows of a data file,
+// every request gets a row as .Data in its templates, e.g. {{.Data.user}}.
+// CSV files name the columns in their first line, JSONL files hold an object
+// per line.
+type Feeder struct {
+	File        string `json:"file"`
+	Mode        string `json:"mode"`        // sequential (default), random or partition
+	OnExhausted string `json:"onExhausted"` // wrap (default) or stop
+	feed        *feed
+}
+
+// feed is the state of a loaded feeder.
+type feed struct {
+	lock       sync.Mutex
+	rows       []map[string]string
+	order      []int // order of the rows in random mode
+	next       int
+	partitions map[int]int // next row of every worker in partition mode
+	random     *rand.Rand
+}
+
+func validateFeeder(f *Feeder) []ConfigError {
+	var errs []ConfigError
+	if f.File == "" {
+		return nil
+	}
+	if f.Mode != "" && !helpers.Contains(ValidFeederModes, f.Mode) {
+		errs = append(errs, ConfigError{"feeder.mode", fmt.Sprintf("Invalid feeder mode %s. Valid modes: %v", f.Mode, ValidFeederModes)})
+	}
+	if f.OnExhausted != "" && !helpers.Contains(ValidFeederEnds, f.OnExhausted) {
+		errs = append(errs, ConfigError{"feeder.onExhausted", fmt.Sprintf("Invalid value %s. Valid values: %v", f.OnExhausted, ValidFeederEnds)})
+	}
+	return errs
+}
+
+// sampleData returns the data of the first row to check templates against,
+// nil when there is no feeder.
+func (f *Feeder) sampleData() (map[string]string, []ConfigError) {
+	if f.File == "" {
+		return nil, nil
+	}
+	rows, err := readFeederRows(f.File)
+	if err != nil {
+		return nil, []ConfigError{{"feeder.file", err.Error()}}
+	}
+	return rows[0], nil
+}
+
+// load reads the rows of the file.
+func (f *Feeder) load() error {
+	if f.File == "" {
+		f.feed = nil
+		return nil
+	}
+	rows, err := readFeederRows(f.File)
+	if err != nil {
+		return fmt.Errorf("Feeder %s: %s", f.File, err)
+	}
+	f.feed = &feed{
+		rows:       rows,
+		partitions: make(map[int]int),
+		random:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	if f.Mode == FeederRandom {
+		f.feed.order = f.feed.random.Perm(len(rows))
+	}
+	return nil
+}
+
+// row returns the row of the call, false once the rows are used and the
+// feeder stops. In partition mode the worker count of the run gives the
+// number of partitions. A worker without rows is exhausted right away, on
+// wrap workers beyond the rows share them, worker w takes the row w modulo
+// the row count.
+func (f *Feeder) row(iter Iteration) (map[string]string, bool) {
+	if f.feed == nil {
+		return nil, true
+	}
+	feed := f.feed
+	feed.lock.Lock()
+	defer feed.lock.Unlock()
+	wrap := f.OnExhausted != FeederStop
+	switch f.Mode {
+	case FeederPartition:
+		workers := iter.Workers
+		if workers < 1 {
+			workers = 1
+		}
+		index := iter.Worker + feed.partitions[iter.Worker]*workers
+		if index >= len(feed.rows) {
+			if !wrap {
+				return nil, false
+			}
+			index = iter.Worker % len(feed.rows)
+			feed.partitions[iter.Worker] = 0
+		}
+		feed.partitions[iter.Worker]++
+		return feed.rows[index], true
+	case FeederRandom:
+		if feed.next >= len(feed.rows) {
+			if !wrap {
+				return nil, false
+			}
+			feed.order = feed.random.Perm(len(feed.rows))
+			feed.next = 0
+		}
+		feed.next++
+		return feed.rows[feed.order[feed.next-1]], true
+	default:
+		if feed.next >= len(feed.rows) {
+			if !wrap {
+				return nil, false
+			}
+			feed.next = 0
+		}
+		feed.next++
+		return feed.rows[feed.next-1], true
+	}
+}
+
+// readFeederRows reads a CSV or JSONL file picked by its extension, files
+// with an unknown extension are read as CSV.
+func readFeederRows(path string) ([]map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rows []map[string]string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl", ".ndjson":
+		rows, err = readJsonlRows(data)
+	default:
+		rows, err = readCsvRows(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("No rows to feed")
+	}
+	return rows, nil
+}
+
+func readCsvRows(data []byte) ([]map[string]string, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid CSV: %s", err)
+	}
+	var rows []map[string]string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid CSV: %s", err)
+		}
+		row := make(map[string]string, len(header))
+		for i, name := range header {
+			row[name] = record[i]
+		}
+		rows = append(rows, row)
+	}
+}
+
+// readJsonlRows reads an object per line, values other than strings are kept
+// in their JSON form.
+func readJsonlRows(data []byte) ([]map[string]string, error) {
+	var rows []map[string]string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(text), &object); err != nil {
+			return nil, fmt.Errorf("Invalid JSON on line %d: %s", line, err)
+		}
+		row := make(map[string]string, len(object))
+		for key, value := range object {
+			var s string
+			if json.Unmarshal(value, &s) == nil {
+				row[key] = s
+			} else {
+				row[key] = string(value)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+func bindFeederFlags(flags *pflag.FlagSet, f *Feeder) {
+	flags.StringVar(&f.File, "feeder", "", fmt.Sprintf("Data file in one of the formats %v, every request gets a row as {{.Data.column}}", FeederFormats))
+	flags.StringVar(&f.Mode, "feeder-mode", FeederSequential, fmt.Sprintf("How the rows are taken %v", ValidFeederModes))
+	flags.StringVar(&f.OnExhausted, "feeder-end", FeederWrap, fmt.Sprintf("What happens once the rows are used %v", ValidFeederEnds))
+}
@@ -0,0 +1,145 @@
+package protocols
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeFeederFile writes rows of a single column named id.
+func writeFeederFile(t *testing.T, ids ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rows.csv")
+	if err := os.WriteFile(path, []byte("id\n"+strings.Join(ids, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// call is a call of the feeder by a worker.
+type call struct {
+	worker int
+	want   string // id of the row, empty when the feeder is exhausted
+}
+
+func TestFeederRow(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		end     string
+		workers int
+		calls   []call
+	}{
+		{"sequential wrap", FeederSequential, FeederWrap, 2, []call{
+			{0, "a"}, {1, "b"}, {0, "c"}, {1, "a"}, {0, "b"},
+		}},
+		{"sequential stop", FeederSequential, FeederStop, 2, []call{
+			{0, "a"}, {1, "b"}, {0, "c"}, {1, ""}, {0, ""},
+		}},
+		{"partition wrap", FeederPartition, FeederWrap, 2, []call{
+			{0, "a"}, {1, "b"}, {0, "c"}, {1, "b"}, {0, "a"}, {0, "c"},
+		}},
+		{"partition stop", FeederPartition, FeederStop, 2, []call{
+			{0, "a"}, {1, "b"}, {1, ""}, {0, "c"}, {0, ""},
+		}},
+		{"partition wrap beyond the rows", FeederPartition, FeederWrap, 5, []call{
+			{3, "a"}, {4, "b"}, {3, "a"}, {2, "c"}, {4, "b"},
+		}},
+		{"partition stop beyond the rows", FeederPartition, FeederStop, 5, []call{
+			{3, ""}, {0, "a"}, {0, ""},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &Feeder{File: writeFeederFile(t, "a", "b", "c"), Mode: tt.mode, OnExhausted: tt.end}
+			if err := f.load(); err != nil {
+				t.Fatal(err)
+			}
+			for i, c := range tt.calls {
+				row, ok := f.row(Iteration{Worker: c.worker, Workers: tt.workers})
+				if got := row["id"]; got != c.want || ok != (c.want != "") {
+					t.Errorf("call %d of worker %d got %q, %v, want %q", i, c.worker, got, ok, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFeederRandom(t *testing.T) {
+	path := writeFeederFile(t, "a", "b", "c")
+	// takes rows until the feeder is exhausted or n rows are taken
+	take := func(f *Feeder, n int) string {
+		var ids []string
+		for len(ids) < n {
+			row, ok := f.row(Iteration{})
+			if !ok {
+				break
+			}
+			ids = append(ids, row["id"])
+		}
+		sort.Strings(ids)
+		return strings.Join(ids, "")
+	}
+
+	stop := &Feeder{File: path, Mode: FeederRandom, OnExhausted: FeederStop}
+	if err := stop.load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := take(stop, 10); got != "abc" {
+		t.Errorf("stop took rows %s, want every row once", got)
+	}
+
+	wrap := &Feeder{File: path, Mode: FeederRandom, OnExhausted: FeederWrap}
+	if err := wrap.load(); err != nil {
+		t.Fatal(err)
+	}
+	for round := 0; round < 2; round++ {
+		if got := take(wrap, 3); got != "abc" {
+			t.Errorf("wrap round %d took rows %s, want every row once", round, got)
+		}
+	}
+}
+
+func TestReadFeederRows(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		file    string
+		content string
+		want    []map[string]string
+		err     bool
+	}{
+		{"users.csv", "user,token\nalice,t1\nbob,t2\n", []map[string]string{
+			{"user": "alice", "token": "t1"}, {"user": "bob", "token": "t2"},
+		}, false},
+		{"users.jsonl", "{\"user\":\"alice\",\"id\":1}\n\n{\"user\":\"bob\",\"tags\":[\"x\"]}\n", []map[string]string{
+			{"user": "alice", "id": "1"}, {"user": "bob", "tags": `["x"]`},
+		}, false},
+		{"header.csv", "user,token\n", nil, true},
+		{"broken.jsonl", "{\"user\":\n", nil, true},
+		{"short.csv", "user,token\nalice\n", nil, true},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.file)
+		if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		rows, err := readFeederRows(path)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: got error %v, want error %v", tt.file, err, tt.err)
+			continue
+		}
+		if len(rows) != len(tt.want) {
+			t.Errorf("%s: got %d rows, want %d", tt.file, len(rows), len(tt.want))
+			continue
+		}
+		for i, row := range rows {
+			for key, value := range tt.want[i] {
+				if row[key] != value {
+					t.Errorf("%s: row %d has %s=%q, want %q", tt.file, i, key, row[key], value)
+				}
+			}
+		}
+	}
+}
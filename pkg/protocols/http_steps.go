@@ -0,0 +1,283 @@
+package protocols
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/BatikanHyt/netbench/pkg/helpers"
+)
+
+// HttpStep is a request of a multi-step flow. Every call of the benchmark is
+// a virtual user sending the steps in order, each step is reported with its
+// own statistics. A failing step ends the flow of the call. Url may be
+// relative to the url of the client, Headers are added to the headers of the
+// client and Method is GET unless set.
+type HttpStep struct {
+	Name    string            `json:"name"`
+	Method  string            `json:"method"`
+	Url     string            `json:"url"`
+	Body    string            `json:"body"`
+	Headers map[string]string `json:"headers"`
+	Extract []Extract         `json:"extract"`
+}
+
+// Extract stores a value of the response of a step in a variable, the
+// following steps of the flow read it as {{.Vars.<var>}}. One of JsonPath,
+// Regex and Header selects the value.
+type Extract struct {
+	Var      string `json:"var"`
+	JsonPath string `json:"jsonPath"` // in the JSON body, e.g. $.data.token or $.items[0].id
+	Regex    string `json:"regex"`    // in the body, the first group or the whole match
+	Header   string `json:"header"`   // response header
+}
+
+// httpStep is a parsed HttpStep.
+type httpStep struct {
+	name       string
+	method     string
+	templates  *httpTemplates
+	extractors []*extractor
+	readBody   bool // an extractor needs the body
+}
+
+type extractor struct {
+	name   string
+	header string
+	path   []interface{} // keys and indexes of the JSONPath
+	regex  *regexp.Regexp
+}
+
+// parseSteps parses the steps of the client, funcs are shared with the
+// templates of the client.
+func (c *HttpClient) parseSteps(funcs template.FuncMap) ([]*httpStep, []ConfigError) {
+	var errs []ConfigError
+	var steps []*httpStep
+	names := make(map[string]bool)
+	for i, s := range c.Steps {
+		path := fmt.Sprintf("steps[%d].", i)
+		step := &httpStep{name: s.Name, method: s.Method}
+		if step.method == "" {
+			step.method = "GET"
+		}
+		if s.Name == "" {
+			errs = append(errs, ConfigError{path + "name", "Missing required field"})
+		} else if names[s.Name] {
+			errs = append(errs, ConfigError{path + "name", fmt.Sprintf("Duplicate step name %s", s.Name)})
+		}
+		names[s.Name] = true
+		if !helpers.Contains(validMethod, step.method) {
+			errs = append(errs, ConfigError{path + "method", fmt.Sprintf("Invalid HTTP methods %s. Valid methods: %v", step.method, validMethod)})
+		}
+		if s.Url == "" {
+			errs = append(errs, ConfigError{path + "url", "Missing required field"})
+		}
+		headers := make(map[string]string, len(c.Headers)+len(s.Headers))
+		for key, value := range c.Headers {
+			headers[key] = value
+		}
+		for key, value := range s.Headers {
+			headers[key] = value
+		}
+		templates, tErrs := parseHttpTemplates(path, s.Url, s.Body, headers, funcs)
+		errs = append(errs, tErrs...)
+		step.templates = templates
+		for j, e := range s.Extract {
+			extractor, err := newExtractor(e)
+			if err != nil {
+				errs = append(errs, ConfigError{fmt.Sprintf("%sextract[%d]", path, j), err.Error()})
+				continue
+			}
+			step.extractors = append(step.extractors, extractor)
+			step.readBody = step.readBody || extractor.header == ""
+		}
+		steps = append(steps, step)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return steps, nil
+}
+
+// validateSteps renders the templates of the steps against data, the
+// variables extracted by a step are known to the following ones.
+func validateSteps(steps []*httpStep, base *requestTemplate, data *TemplateData) []ConfigError {
+	var errs []ConfigError
+	vars := make(map[string]string, len(data.Vars))
+	for key, value := range data.Vars {
+		vars[key] = value
+	}
+	data = &TemplateData{Vars: vars, Data: data.Data}
+	baseUrl, _ := base.execute(data)
+	for i, step := range steps {
+		path := fmt.Sprintf("steps[%d].", i)
+		if rawUrl, err := step.templates.url.execute(data); err != nil {
+			errs = append(errs, ConfigError{path + "url", err.Error()})
+		} else if rawUrl = resolveStepUrl(baseUrl, rawUrl); !isHttpUrl(rawUrl) {
+			errs = append(errs, ConfigError{path + "url", fmt.Sprintf("Invalid URL %q, expected http(s)://host[:port]/path or a path relative to the url", rawUrl)})
+		}
+		if _, err := step.templates.body.execute(data); err != nil {
+			errs = append(errs, ConfigError{path + "body", err.Error()})
+		}
+		for _, key := range step.templates.headerKeys() {
+			if _, err := step.templates.headers[key].execute(data); err != nil {
+				errs = append(errs, ConfigError{path + "headers." + key, err.Error()})
+			}
+		}
+		for _, extractor := range step.extractors {
+			vars[extractor.name] = ""
+		}
+	}
+	return errs
+}
+
+// resolveStepUrl resolves the url of a step against the url of the client.
+func resolveStepUrl(base string, rawUrl string) string {
+	if base == "" || isHttpUrl(rawUrl) {
+		return rawUrl
+	}
+	baseUrl, err := url.Parse(base)
+	if err != nil {
+		return rawUrl
+	}
+	ref, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+	return baseUrl.ResolveReference(ref).String()
+}
+
+func newExtractor(e Extract) (*extractor, error) {
+	if e.Var == "" {
+		return nil, errors.New("Missing var to store the value in")
+	}
+	set := 0
+	for _, source := range []string{e.JsonPath, e.Regex, e.Header} {
+		if source != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, errors.New("Set exactly one of jsonPath, regex and header")
+	}
+	extractor := &extractor{name: e.Var, header: e.Header}
+	var err error
+	if e.JsonPath != "" {
+		if extractor.path, err = parseJsonPath(e.JsonPath); err != nil {
+			return nil, err
+		}
+	}
+	if e.Regex != "" {
+		if extractor.regex, err = regexp.Compile(e.Regex); err != nil {
+			return nil, fmt.Errorf("Invalid regex %q: %s", e.Regex, err)
+		}
+	}
+	return extractor, nil
+}
+
+// extract returns the value of the response, body is read only when an
+// extractor of the step needs it.
+func (e *extractor) extract(header http.Header, body []byte) (string, error) {
+	switch {
+	case e.header != "":
+		values := header.Values(e.header)
+		if len(values) == 0 {
+			return "", fmt.Errorf("No %s header in the response", e.header)
+		}
+		return values[0], nil
+	case e.regex != nil:
+		match := e.regex.FindSubmatch(body)
+		if match == nil {
+			return "", fmt.Errorf("No match of %s in the response", e.regex)
+		}
+		if len(match) > 1 {
+			return string(match[1]), nil
+		}
+		return string(match[0]), nil
+	}
+	var document interface{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return "", fmt.Errorf("Response is not JSON: %s", err)
+	}
+	value, err := lookupJsonPath(document, e.path)
+	if err != nil {
+		return "", err
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	data, _ := json.Marshal(value)
+	return string(data), nil
+}
+
+// parseJsonPath parses the subset of JSONPath selecting a single value:
+// $.key, $['key'] and $[index], in any combination.
+func parseJsonPath(path string) ([]interface{}, error) {
+	invalid := fmt.Errorf("Invalid JSONPath %q, expected e.g. $.data.items[0].id", path)
+	if !strings.HasPrefix(path, "$") {
+		return nil, invalid
+	}
+	var parts []interface{}
+	rest := path[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, invalid
+			}
+			parts = append(parts, key)
+			rest = rest[end+1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, invalid
+			}
+			selector := rest[1:end]
+			if len(selector) >= 2 && (selector[0] == '\'' || selector[0] == '"') && selector[len(selector)-1] == selector[0] {
+				parts = append(parts, selector[1:len(selector)-1])
+			} else if index, err := strconv.Atoi(selector); err == nil && index >= 0 {
+				parts = append(parts, index)
+			} else {
+				return nil, invalid
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, invalid
+		}
+	}
+	return parts, nil
+}
+
+func lookupJsonPath(document interface{}, path []interface{}) (interface{}, error) {
+	value := document
+	for _, part := range path {
+		switch part := part.(type) {
+		case string:
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("No key %s in the response, not an object", part)
+			}
+			if value, ok = object[part]; !ok {
+				return nil, fmt.Errorf("No key %s in the response", part)
+			}
+		case int:
+			list, ok := value.([]interface{})
+			if !ok || part >= len(list) {
+				return nil, fmt.Errorf("No index %d in the response", part)
+			}
+			value = list[part]
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,148 @@
+package protocols
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseJsonPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want []interface{}
+		err  bool
+	}{
+		{"$", nil, false},
+		{"$.data", []interface{}{"data"}, false},
+		{"$.data.token", []interface{}{"data", "token"}, false},
+		{"$.items[0].id", []interface{}{"items", 0, "id"}, false},
+		{"$[2]", []interface{}{2}, false},
+		{"$['odd key'].value", []interface{}{"odd key", "value"}, false},
+		{`$["quoted"][1][0]`, []interface{}{"quoted", 1, 0}, false},
+		{"data.token", nil, true},
+		{"$.", nil, true},
+		{"$..token", nil, true},
+		{"$.items[", nil, true},
+		{"$.items[-1]", nil, true},
+		{"$.items[*]", nil, true},
+		{"$.items[?(@.id)]", nil, true},
+		{"$x", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseJsonPath(tt.path)
+		if (err != nil) != tt.err {
+			t.Errorf("parseJsonPath(%q) error %v, want error %v", tt.path, err, tt.err)
+			continue
+		}
+		if !tt.err && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseJsonPath(%q) = %#v, want %#v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestLookupJsonPath(t *testing.T) {
+	var document interface{}
+	body := `{"data": {"token": "abc", "ttl": 60}, "items": [{"id": 7}, {"id": 8, "tags": ["x"]}], "empty": null}`
+	if err := json.Unmarshal([]byte(body), &document); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want interface{}
+		err  bool
+	}{
+		{"$.data.token", "abc", false},
+		{"$.data.ttl", 60.0, false},
+		{"$.items[1].id", 8.0, false},
+		{"$.items[1].tags[0]", "x", false},
+		{"$.empty", nil, false},
+		{"$.data.missing", nil, true},
+		{"$.items[2]", nil, true},
+		{"$.data[0]", nil, true},
+		{"$.items.id", nil, true},
+		{"$.data.token.value", nil, true},
+	}
+	for _, tt := range tests {
+		path, err := parseJsonPath(tt.path)
+		if err != nil {
+			t.Fatalf("parseJsonPath(%q): %s", tt.path, err)
+		}
+		got, err := lookupJsonPath(document, path)
+		if (err != nil) != tt.err {
+			t.Errorf("lookupJsonPath(%q) error %v, want error %v", tt.path, err, tt.err)
+			continue
+		}
+		if !tt.err && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("lookupJsonPath(%q) = %#v, want %#v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	header := http.Header{"X-Session": []string{"s1", "s2"}}
+	body := []byte(`{"data": {"token": "abc", "ids": [1, 2]}, "html": "<input name='csrf' value='c5'>"}`)
+	tests := []struct {
+		extract Extract
+		want    string
+		err     bool
+	}{
+		{Extract{Var: "token", JsonPath: "$.data.token"}, "abc", false},
+		{Extract{Var: "ids", JsonPath: "$.data.ids"}, "[1,2]", false},
+		{Extract{Var: "id", JsonPath: "$.data.ids[1]"}, "2", false},
+		{Extract{Var: "csrf", Regex: `value='(\w+)'`}, "c5", false},
+		{Extract{Var: "name", Regex: `name='\w+'`}, "name='csrf'", false},
+		{Extract{Var: "session", Header: "x-session"}, "s1", false},
+		{Extract{Var: "missing", JsonPath: "$.data.missing"}, "", true},
+		{Extract{Var: "missing", Regex: "nomatch"}, "", true},
+		{Extract{Var: "missing", Header: "X-Missing"}, "", true},
+	}
+	for _, tt := range tests {
+		extractor, err := newExtractor(tt.extract)
+		if err != nil {
+			t.Fatalf("newExtractor(%+v): %s", tt.extract, err)
+		}
+		got, err := extractor.extract(header, body)
+		if (err != nil) != tt.err {
+			t.Errorf("extract %+v error %v, want error %v", tt.extract, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("extract %+v = %q, want %q", tt.extract, got, tt.want)
+		}
+	}
+	if _, err := (&extractor{path: []interface{}{"a"}}).extract(header, []byte("not json")); err == nil {
+		t.Errorf("extracted a JSONPath from a body that is not JSON")
+	}
+}
+
+func TestNewExtractorInvalid(t *testing.T) {
+	for _, e := range []Extract{
+		{JsonPath: "$.token"},
+		{Var: "token"},
+		{Var: "token", JsonPath: "$.token", Header: "X-Token"},
+		{Var: "token", JsonPath: "token"},
+		{Var: "token", Regex: "("},
+	} {
+		if _, err := newExtractor(e); err == nil {
+			t.Errorf("newExtractor(%+v) accepted an invalid extract", e)
+		}
+	}
+}
+
+func TestResolveStepUrl(t *testing.T) {
+	tests := []struct {
+		base, url, want string
+	}{
+		{"http://host:8080/api/", "login", "http://host:8080/api/login"},
+		{"http://host:8080/api/", "/login", "http://host:8080/login"},
+		{"http://host:8080/api", "items?page=2", "http://host:8080/items?page=2"},
+		{"http://host:8080/", "https://other/x", "https://other/x"},
+		{"", "/login", "/login"},
+	}
+	for _, tt := range tests {
+		if got := resolveStepUrl(tt.base, tt.url); got != tt.want {
+			t.Errorf("resolveStepUrl(%q, %q) = %q, want %q", tt.base, tt.url, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package protocols
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/BatikanHyt/netbench/pkg/collector"
+)
+
+// requestTrace records the phases of a single HTTP request from the
+// httptrace callbacks. Dial callbacks can run on other goroutines than the
+// request, so every field is guarded by the lock.
+type requestTrace struct {
+	lock         sync.Mutex
+	wire         byteCounter
+	gotConn      bool
+	reused       bool
+	dnsFailed    bool
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+}
+
+func (t *requestTrace) clientTrace() *httptrace.ClientTrace {
+	now := func(field *time.Time) {
+		t.lock.Lock()
+		if field.IsZero() {
+			*field = time.Now()
+		}
+		t.lock.Unlock()
+	}
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { now(&t.dnsStart) },
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			now(&t.dnsDone)
+			if info.Err != nil {
+				t.lock.Lock()
+				t.dnsFailed = true
+				t.lock.Unlock()
+			}
+		},
+		// with several addresses the first successful dial ends the phase
+		ConnectStart: func(string, string) { now(&t.connectStart) },
+		ConnectDone: func(network, addr string, err error) {
+			if err == nil {
+				now(&t.connectDone)
+			}
+		},
+		TLSHandshakeStart: func() { now(&t.tlsStart) },
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err == nil {
+				now(&t.tlsDone)
+			}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.lock.Lock()
+			t.gotConn = true
+			t.reused = info.Reused
+			t.wire.mark(info.Conn)
+			t.lock.Unlock()
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { now(&t.wroteRequest) },
+		GotFirstResponseByte: func() { now(&t.firstByte) },
+	}
+}
+
+// bytes claims the bytes read and written on the connection of the request.
+func (t *requestTrace) bytes() (int64, int64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.wire.sample()
+}
+
+// phases returns the duration of every phase the request went through, a
+// reused connection has no dns, connect or tls phase. ttfb is measured from
+// the request being written until the first response byte, transfer from
+// there until end, when the body was read completely.
+func (t *requestTrace) phases(end time.Time) []collector.Phase {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	var phases []collector.Phase
+	add := func(name string, start, done time.Time) {
+		if !start.IsZero() && !done.IsZero() {
+			phases = append(phases, collector.Phase{Name: name, Duration: done.Sub(start)})
+		}
+	}
+	add("dns", t.dnsStart, t.dnsDone)
+	add("connect", t.connectStart, t.connectDone)
+	add("tls", t.tlsStart, t.tlsDone)
+	add("ttfb", t.wroteRequest, t.firstByte)
+	add("transfer", t.firstByte, end)
+	return phases
+}
+
+// failedPhase returns the phase a failed request stopped in.
+func (t *requestTrace) failedPhase() string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	switch {
+	case t.dnsFailed, !t.dnsStart.IsZero() && t.dnsDone.IsZero():
+		return "dns"
+	case !t.tlsStart.IsZero() && t.tlsDone.IsZero():
+		return "tls"
+	case !t.gotConn:
+		return "connect"
+	case t.wroteRequest.IsZero():
+		return "write"
+	case t.firstByte.IsZero():
+		return "ttfb"
+	}
+	return "transfer"
+}
+
+// labels tells whether the request got a new or a reused connection.
+func (t *requestTrace) labels() map[string]string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if !t.gotConn {
+		return nil
+	}
+	if t.reused {
+		return map[string]string{"connection": "reused"}
+	}
+	return map[string]string{"connection": "new"}
+}
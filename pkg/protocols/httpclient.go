@@ -3,25 +3,45 @@ package protocols
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"os"
+	"sort"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/BatikanHyt/netbench/pkg/collector"
+	"github.com/BatikanHyt/netbench/pkg/helpers"
+	"github.com/spf13/pflag"
 	"golang.org/x/net/http2"
 )
 
-type httpClient struct {
+var validMethod = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+var validVersions = []string{"1", "1.1", "2"}
+
+func init() {
+	Register(Definition{
+		Name:       "http",
+		Use:        "http [URI]",
+		Short:      "Benchmark an http/s server",
+		New:        func() BaseProtocol { return NewHttpClient() },
+		Classifier: collector.HttpClassifier{},
+		BindFlags:  bindHttpFlags,
+		Args:       httpArgs,
+		Validate:   validateHttp,
+	})
+}
+
+type HttpClient struct {
 	Client      *http.Client
 	Req         *http.Request
-	ReportChan  chan *collector.HttpEntry
-	readSize    int64
-	writeSize   int64
+	stat        collector.StatBase
 	Url         string            `json:"url"`
 	Method      string            `json:"method"`
 	Version     string            `json:"version"`
@@ -29,19 +49,25 @@ type httpClient struct {
 	BodyFile    string            `json:"body_file"`
 	Proxy       string            `json:"proxy"`
 	Headers     map[string]string `json:"headers"`
+	Vars        map[string]string `json:"vars"` // available to the templates as .Vars
+	Feeder      Feeder            `json:"feeder"`
+	Steps       []HttpStep        `json:"steps"` // a flow of requests instead of the single request
 	Timeout     time.Duration     `json:"Timeout"`
 	Keep_alive  bool              `json:"keep-alive"`
 	Compression bool              `json:"compression"`
 	Redirect    bool              `json:"redirect"`
 	initialized bool
+	body        []byte // content of BodyFile
+	templates   *httpTemplates
+	steps       []*httpStep
 	Auth        struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
 	} `json:"auth"`
 }
 
-func NewHttpClient() *httpClient {
-	client := &httpClient{
+func NewHttpClient() *HttpClient {
+	client := &HttpClient{
 		Method:      "GET",
 		Version:     "1.1",
 		initialized: false,
@@ -49,14 +75,159 @@ func NewHttpClient() *httpClient {
 	return client
 }
 
-func (c *httpClient) Initialize(clc *collector.StatBase) {
-	hclc, _ := (*clc).(*collector.HttpStatCollector)
-	c.ReportChan = hclc.StatChannel
+func bindHttpFlags(flags *pflag.FlagSet, protocol BaseProtocol) {
+	client := protocol.(*HttpClient)
+	flags.StringVarP(&client.Method, "method", "m", "GET", "Http method to use")
+	flags.StringToStringVarP(&client.Headers, "headers", "H", map[string]string{}, "Headers in key=value format and comma(,) separated")
+	flags.StringVarP(&client.Version, "Version", "v", "1", "HTTP version 1 or 2")
+	flags.StringVarP(&client.Body, "body", "b", "", "HTTP body to send")
+	flags.StringToStringVar(&client.Vars, "var", map[string]string{}, "Template variables in key=value format and comma(,) separated, used as {{.Vars.key}}")
+	flags.StringVarP(&client.BodyFile, "body_file", "f", "", "File to send as http body")
+	bindFeederFlags(flags, &client.Feeder)
+	flags.DurationVarP(&client.Timeout, "time_out", "t", time.Second, "Request timeout, e.g. 10s")
+	flags.BoolVar(&client.Keep_alive, "keep_alive", true, "Toggle keep-alive, --keep_alive=[true|false]")
+	flags.BoolVar(&client.Compression, "compression", false, "Toggle compression --compression=[true|false]")
+	flags.BoolVar(&client.Redirect, "redirect", false, "Toggle redirect --redirect=[true|false]")
+}
+
+func httpArgs(protocol BaseProtocol, args []string) error {
+	client := protocol.(*HttpClient)
+	if len(args) > 0 {
+		client.Url = args[0]
+	}
+	if client.Url == "" && len(client.Steps) == 0 {
+		return errors.New("Need to define target URI")
+	}
+	if errs := validateHttp(client); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+func validateHttp(protocol BaseProtocol) []ConfigError {
+	client := protocol.(*HttpClient)
+	var errs []ConfigError
+	errs = append(errs, validateFeeder(&client.Feeder)...)
+	templates, steps, tErrs := client.parseTemplates()
+	errs = append(errs, tErrs...)
+	sample, sErrs := client.Feeder.sampleData()
+	errs = append(errs, sErrs...)
+	if client.Url == "" && len(client.Steps) == 0 {
+		errs = append(errs, ConfigError{"url", "Missing required field"})
+	} else if templates != nil && len(sErrs) == 0 {
+		// a templated url is checked once rendered, with steps it is
+		// optional and the base of their relative urls
+		data := &TemplateData{Vars: client.Vars, Data: sample}
+		if rawUrl, err := templates.url.execute(data); err != nil {
+			errs = append(errs, ConfigError{"url", err.Error()})
+		} else if (rawUrl != "" || len(steps) == 0) && !isHttpUrl(rawUrl) {
+			errs = append(errs, ConfigError{"url", fmt.Sprintf("Invalid URL %q, expected http(s)://host[:port]/path", rawUrl)})
+		}
+		if _, err := templates.body.execute(data); err != nil {
+			errs = append(errs, ConfigError{"body", err.Error()})
+		}
+		for _, key := range templates.headerKeys() {
+			if _, err := templates.headers[key].execute(data); err != nil {
+				errs = append(errs, ConfigError{"headers." + key, err.Error()})
+			}
+		}
+		errs = append(errs, validateSteps(steps, templates.url, data)...)
+	}
+	if !helpers.Contains(validMethod, client.Method) {
+		errs = append(errs, ConfigError{"method", fmt.Sprintf("Invalid HTTP methods %s. Valid methods: %v", client.Method, validMethod)})
+	}
+	if !helpers.Contains(validVersions, client.Version) {
+		errs = append(errs, ConfigError{"version", fmt.Sprintf("Invalid HTTP version %s. Valid versions: %v", client.Version, validVersions)})
+	}
+	if client.Proxy != "" && !isHttpUrl(client.Proxy) {
+		errs = append(errs, ConfigError{"proxy", fmt.Sprintf("Invalid proxy URL %q, expected http(s)://host[:port]", client.Proxy)})
+	}
+	if client.Timeout < 0 {
+		errs = append(errs, ConfigError{"timeout", "Timeout cannot be negative"})
+	}
+	return errs
+}
+
+// httpTemplates are the parts of a request evaluated per request.
+type httpTemplates struct {
+	url     *requestTemplate
+	body    *requestTemplate
+	headers map[string]*requestTemplate
+}
+
+// parseTemplates parses the url, the body and the header values of the
+// request and of the steps, the body read from BodyFile is sent as it is.
+func (c *HttpClient) parseTemplates() (*httpTemplates, []*httpStep, []ConfigError) {
+	funcs := templateFuncs()
+	templates, errs := parseHttpTemplates("", c.Url, c.Body, c.Headers, funcs)
+	steps, sErrs := c.parseSteps(funcs)
+	errs = append(errs, sErrs...)
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+	return templates, steps, nil
+}
+
+// parseHttpTemplates parses the templates of a request, path prefixes the
+// paths of the errors.
+func parseHttpTemplates(path string, rawUrl string, body string, headers map[string]string, funcs template.FuncMap) (*httpTemplates, []ConfigError) {
+	var errs []ConfigError
+	templates := &httpTemplates{headers: make(map[string]*requestTemplate)}
+	var err error
+	if templates.url, err = newRequestTemplate("url", rawUrl, funcs); err != nil {
+		errs = append(errs, ConfigError{path + "url", err.Error()})
+	}
+	if templates.body, err = newRequestTemplate("body", body, funcs); err != nil {
+		errs = append(errs, ConfigError{path + "body", err.Error()})
+	}
+	for _, key := range sortedKeys(headers) {
+		if templates.headers[key], err = newRequestTemplate(key, headers[key], funcs); err != nil {
+			errs = append(errs, ConfigError{path + "headers." + key, err.Error()})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return templates, nil
+}
+
+func (t *httpTemplates) headerKeys() []string {
+	keys := make([]string, 0, len(t.headers))
+	for key := range t.headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func isHttpUrl(rawUrl string) bool {
+	u, err := url.Parse(rawUrl)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func (c *HttpClient) Initialize(stat collector.StatBase) error {
+	c.stat = stat
+	if c.BodyFile != "" {
+		content, err := os.ReadFile(c.BodyFile)
+		if err != nil {
+			return err
+		}
+		c.body = content
+	}
+	templates, steps, errs := c.parseTemplates()
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	c.templates = templates
+	c.steps = steps
+	if err := c.Feeder.load(); err != nil {
+		return err
+	}
 	tr := &http.Transport{
 		DisableKeepAlives:  !c.Keep_alive,
 		DisableCompression: !c.Compression,
 		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
-			return DialContextWithBytesTracked(ctx, network, address, &c.readSize, &c.writeSize)
+			return DialContextWithBytesTracked(ctx, network, address)
 		},
 	}
 
@@ -66,15 +237,14 @@ func (c *httpClient) Initialize(clc *collector.StatBase) {
 
 	if c.Proxy != "" {
 		proxyUrl, err := url.Parse(c.Proxy)
-		if err == nil {
-			fmt.Printf("Unable to set proxy %s", c.Proxy)
-			return
+		if err != nil {
+			return fmt.Errorf("Unable to set proxy %s: %s", c.Proxy, err)
 		}
 		tr.Proxy = http.ProxyURL(proxyUrl)
 	}
 	c.Client = &http.Client{
 		Transport: tr,
-		Timeout:   time.Second * c.Timeout}
+		Timeout:   c.Timeout}
 
 	//Disable Redirect
 	if !c.Redirect {
@@ -82,82 +252,183 @@ func (c *httpClient) Initialize(clc *collector.StatBase) {
 			return http.ErrUseLastResponse
 		}
 	}
-	fmt.Printf("Running HTTP bench for url %s\n", c.Url)
 	c.initialized = true
+	return nil
 }
 
-func (c *httpClient) StartBenchmark() {
+func (c *HttpClient) Describe() string {
+	if len(c.steps) > 0 {
+		names := make([]string, 0, len(c.steps))
+		for _, step := range c.steps {
+			names = append(names, step.name)
+		}
+		return fmt.Sprintf("HTTP bench for the flow %s", strings.Join(names, " -> "))
+	}
+	return fmt.Sprintf("HTTP bench for url %s", c.Url)
+}
+
+func (c *HttpClient) StartBenchmark(ctx context.Context, iter Iteration) {
 	if !c.initialized {
 		fmt.Println("HTTP not initialized correctly!")
 		return
 	}
 
-	c.makeRequest()
+	c.makeRequest(ctx, iter)
+}
+
+func (c *HttpClient) makeRequest(ctx context.Context, iter Iteration) {
+	row, ok := c.Feeder.row(iter)
+	if !ok {
+		iter.Stop()
+		return
+	}
+	data := &TemplateData{
+		Worker:    iter.Worker,
+		Iteration: iter.Seq,
+		Vars:      c.Vars,
+		Data:      row,
+	}
+	if len(c.steps) == 0 {
+		c.send(ctx, iter, nil, data)
+		return
+	}
+	// the values extracted by the steps are added to the variables of the flow
+	data.Vars = make(map[string]string, len(c.Vars))
+	for key, value := range c.Vars {
+		data.Vars[key] = value
+	}
+	for i, step := range c.steps {
+		if i > 0 {
+			// only the first step can be held back by the schedule
+			iter.Scheduled = time.Time{}
+		}
+		if !c.send(ctx, iter, step, data) {
+			return
+		}
+	}
 }
 
-func (c *httpClient) makeRequest() {
+// send sends the request, or the request of step when it is not nil, and
+// reports its entry. It returns false when the request failed or a value
+// could not be extracted from the response.
+func (c *HttpClient) send(ctx context.Context, iter Iteration, step *httpStep, data *TemplateData) bool {
 	start := time.Now()
-	req, rErr := c.createRequest()
+	entry := &collector.Entry{
+		Worker:    iter.Worker,
+		Scheduled: iter.Scheduled,
+		Start:     start,
+	}
+	if step != nil {
+		entry.Step = step.name
+	}
+	req, body, rErr := c.createRequest(step, data)
 	if rErr != nil {
-		fmt.Printf("Error %s\n", rErr.Error())
-		return
+		entry.Duration = time.Since(start)
+		entry.Error = classifyError(ctx, rErr, "prepare")
+		c.stat.Submit(entry)
+		return false
 	}
+	// the request claims the bytes of its connection once it is done
+	trace := &requestTrace{}
+	reqCtx, cancel := iter.context(ctx)
+	defer cancel()
+	req = req.WithContext(httptrace.WithClientTrace(reqCtx, trace.clientTrace()))
 	resp, err := c.Client.Do(req)
 	if err != nil {
-		fmt.Printf("Error %s\n", err.Error())
-		elapsed := time.Since(start)
-		stat := &collector.HttpEntry{
-			ResponseCode: 1000,
-			WriteSize:    c.writeSize,
-			ReadSize:     c.readSize,
-			Duration:     elapsed,
-		}
-		c.ReportChan <- stat
-		return
+		entry.Duration = time.Since(start)
+		entry.Error = classifyError(ctx, err, trace.failedPhase())
+		entry.ReadSize, entry.WriteSize = trace.bytes()
+		entry.BodyWriteSize = body.size()
+		entry.Phases = trace.phases(time.Time{})
+		entry.Labels = trace.labels()
+		c.stat.Submit(entry)
+		return false
 	}
 	defer resp.Body.Close()
-	_, bErr := io.Copy(io.Discard, resp.Body)
+	var received int64
+	var content []byte
+	var bErr error
+	if step != nil && step.readBody {
+		content, bErr = io.ReadAll(resp.Body)
+		received = int64(len(content))
+	} else {
+		received, bErr = io.Copy(io.Discard, resp.Body)
+	}
+	end := time.Now()
+	entry.Status = resp.StatusCode
+	entry.Duration = end.Sub(start)
+	entry.ReadSize, entry.WriteSize = trace.bytes()
+	entry.Labels = trace.labels()
 	if bErr != nil {
-		return
+		entry.Error = classifyError(ctx, bErr, "transfer")
+		entry.Phases = trace.phases(time.Time{})
+	} else {
+		entry.Phases = trace.phases(end)
 	}
-	elapsed := time.Since(start)
-	stat := &collector.HttpEntry{
-		ResponseCode: resp.StatusCode,
-		WriteSize:    c.writeSize,
-		ReadSize:     c.readSize,
-		Duration:     elapsed,
+	entry.BodyReadSize = received
+	entry.BodyWriteSize = body.size()
+	if entry.Error == nil && step != nil {
+		for _, extractor := range step.extractors {
+			value, err := extractor.extract(resp.Header, content)
+			if err != nil {
+				entry.Error = &collector.RequestError{Kind: collector.ErrorExtract, Phase: "extract", Message: err.Error()}
+				break
+			}
+			data.Vars[extractor.name] = value
+		}
 	}
-	c.ReportChan <- stat
+	c.stat.Submit(entry)
+	return entry.Error == nil && resp.StatusCode < 400
 }
 
-func (c *httpClient) createRequest() (*http.Request, error) {
+// createRequest renders the templates of the request, or of the request of
+// step when it is not nil, against data.
+func (c *HttpClient) createRequest(step *httpStep, data *TemplateData) (*http.Request, *countingReader, error) {
 	var dataReader io.Reader
-	var err error
-	var req *http.Request
+	var body *countingReader
 
-	if c.BodyFile != "" {
-		var content []byte
-		content, err = os.ReadFile(c.BodyFile)
+	method, templates := c.Method, c.templates
+	if step != nil {
+		method, templates = step.method, step.templates
+	}
+	rawUrl, err := templates.url.execute(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if step != nil {
+		base, err := c.templates.url.execute(data)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		dataReader = bytes.NewReader(content)
+		rawUrl = resolveStepUrl(base, rawUrl)
+	}
+	if c.BodyFile != "" && step == nil {
+		dataReader = bytes.NewReader(c.body)
 	} else {
-		dataReader = strings.NewReader(c.Body)
+		content, err := templates.body.execute(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		dataReader = strings.NewReader(content)
 	}
-	req, err = http.NewRequest(c.Method, c.Url, io.NopCloser(dataReader))
+	body = &countingReader{Reader: dataReader}
+	req, err := http.NewRequest(method, rawUrl, io.NopCloser(body))
 	if err != nil {
-		return req, err
+		return req, body, err
 	}
 	if c.Auth.Username != "" && c.Auth.Password != "" {
 		req.SetBasicAuth(c.Auth.Username, c.Auth.Password)
 	}
-	for key, value := range c.Headers {
+	for key, tmpl := range templates.headers {
+		value, err := tmpl.execute(data)
+		if err != nil {
+			return req, body, err
+		}
 		if strings.EqualFold(key, "host") {
 			req.Host = value
 		} else {
 			req.Header.Set(key, value)
 		}
 	}
-	return req, err
+	return req, body, nil
 }
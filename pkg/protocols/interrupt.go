@@ -0,0 +1,91 @@
+package protocols
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultDrainTimeout is how long in-flight requests may finish after an
+// interrupt.
+const DefaultDrainTimeout = 10 * time.Second
+
+// trapInterrupt returns a context that is cancelled on the first SIGINT or
+// SIGTERM, a second signal exits the process right away. release stops
+// trapping the signals.
+func trapInterrupt() (ctx context.Context, release func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-signals:
+		case <-done:
+			return
+		}
+		fmt.Printf("\nInterrupted, waiting for in-flight requests. Interrupt again to exit immediately\n")
+		cancel()
+		select {
+		case <-signals:
+			fmt.Printf("Forced exit\n")
+			os.Exit(130)
+		case <-done:
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		close(done)
+		cancel()
+	}
+}
+
+// sleepUntil waits until t, it returns false when ctx is done first.
+func sleepUntil(ctx context.Context, t time.Time) bool {
+	wait := time.Until(t)
+	if wait <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// drain waits for the in-flight requests. Once ctx is done they get the
+// drain timeout to finish, requests still running after it are cancelled.
+func (r *Runner) drain(ctx context.Context, wg *sync.WaitGroup, cancel context.CancelFunc) {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		timeout, err := time.ParseDuration(r.DrainTimeout)
+		if err != nil {
+			timeout = DefaultDrainTimeout
+		}
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-done:
+		case <-timer.C:
+			if !r.Quiet {
+				fmt.Printf("Drain timeout of %s hit, cancelling the requests still in flight\n", timeout)
+			}
+			cancel()
+			<-done
+		}
+	}
+	r.Interrupted = ctx.Err() != nil
+}
@@ -0,0 +1,81 @@
+package protocols
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// runOpenLoop schedules arrivals on a fixed clock of r.Rate requests per second,
+// independent of how fast the server answers. Concurency caps the number of
+// requests in flight; an arrival that finds the pool full waits for a free
+// worker and its response time is still measured from its intended send time,
+// so a stalled server shows up in the latencies instead of being hidden.
+func (r *Runner) runOpenLoop(ctx context.Context, runCtx context.Context, wg *sync.WaitGroup, pool chan int) {
+	duration, _ := time.ParseDuration(r.Duration)
+	start := time.Now()
+	deadline := start.Add(duration)
+
+	printProgress := false
+	if duration > progressTimeThreshold || (duration == 0 && r.TotalRequest > progressRequestThreshhold) {
+		printProgress = true
+	}
+	nextProgress := 1
+
+	for i := 0; ; i++ {
+		if duration == 0 && i >= r.TotalRequest {
+			break
+		}
+		// intended send time of the i-th arrival, computed from the start so
+		// that sleep overshoot does not accumulate into drift
+		intended := start.Add(time.Duration(float64(i) * float64(time.Second) / r.Rate))
+		if duration > 0 && !intended.Before(deadline) {
+			break
+		}
+		if !sleepUntil(ctx, intended) {
+			break
+		}
+		if printProgress && r.progressReached(nextProgress, i, duration, time.Since(start)) {
+			nextProgress++
+			r.printProgress()
+		}
+
+		r.dispatch(ctx, runCtx, wg, pool, intended)
+	}
+}
+
+// dispatch starts the arrival scheduled at intended once a worker is free.
+// An arrival still waiting when the run ends is counted as dropped, one
+// waiting when ctx is done is not started.
+func (r *Runner) dispatch(ctx context.Context, runCtx context.Context, wg *sync.WaitGroup, pool chan int, intended time.Time) {
+	if runCtx.Err() != nil {
+		// a worker freed by the end of the run must not pick it up
+		atomic.AddInt64(&r.Dropped, 1)
+		return
+	}
+	select {
+	case worker := <-pool:
+		wg.Add(1)
+		iter := r.nextIteration(worker, intended)
+		go func() {
+			defer func() {
+				pool <- worker
+				wg.Done()
+			}()
+			r.Protocol.StartBenchmark(runCtx, iter)
+		}()
+	case <-runCtx.Done():
+		atomic.AddInt64(&r.Dropped, 1)
+	case <-ctx.Done():
+	}
+}
+
+// progressReached reports whether the run passed the step-th tenth of its
+// total duration or request count.
+func (r *Runner) progressReached(step int, sent int, duration time.Duration, elapsed time.Duration) bool {
+	if duration > 0 {
+		return elapsed >= duration/10*time.Duration(step)
+	}
+	return sent >= r.TotalRequest/10*step
+}
@@ -0,0 +1,50 @@
+package protocols
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/BatikanHyt/netbench/pkg/collector"
+)
+
+func TestOpenLoopStalledServer(t *testing.T) {
+	// answers 50 requests/sec on a single connection, half the arrival rate
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	client := NewHttpClient()
+	client.Url = server.URL
+	client.Keep_alive = true
+	runner := &Runner{
+		Concurency:   1,
+		Duration:     "1s",
+		Rate:         100,
+		Timeout:      "0s",
+		DrainTimeout: DefaultDrainTimeout.String(),
+		Precision:    collector.DefaultPrecision,
+		Interval:     collector.DefaultInterval.String(),
+		RawLogFormat: collector.RawLogNdjson,
+		Quiet:        true,
+	}
+	if err := runner.SetProtocol("http", client); err != nil {
+		t.Fatal(err)
+	}
+	result, err := runner.RunContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	service, response := result.Stats.ServiceTime.P99, result.Stats.ResponseTime.P99
+	// the arrivals queue up behind the slow server, the last ones wait for
+	// about half of the run
+	if response < 10*service || response < 200*time.Millisecond {
+		t.Errorf("response time p99 %s, want well above service time p99 %s", response, service)
+	}
+	if result.Stats.TotalRequest < 30 {
+		t.Errorf("got %d requests, want the server kept busy", result.Stats.TotalRequest)
+	}
+}
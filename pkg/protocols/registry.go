@@ -0,0 +1,97 @@
+package protocols
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/BatikanHyt/netbench/pkg/collector"
+	"github.com/spf13/pflag"
+)
+
+// Definition describes a protocol to the registry. Once registered the
+// protocol can be used as a key of the JSON config, as a subcommand of the
+// CLI and with the netbench package.
+type Definition struct {
+	Name  string // config key and subcommand name, e.g. http
+	Use   string // usage line of the subcommand, e.g. "http [URI]"
+	Short string // one line description of the subcommand
+	// New returns the protocol with its defaults, the JSON config of the
+	// protocol is decoded into it. Only fields with a json tag are config
+	// keys.
+	New        func() BaseProtocol
+	Classifier collector.Classifier
+	// BindFlags registers the flags of the subcommand on a protocol
+	// returned by New, it is optional
+	BindFlags func(flags *pflag.FlagSet, protocol BaseProtocol)
+	// Args applies the positional arguments of the subcommand, e.g. the
+	// target address, and validates the protocol. The protocol may already
+	// be set from a config file. It is optional.
+	Args func(protocol BaseProtocol, args []string) error
+	// Validate checks a decoded protocol, e.g. for missing required fields,
+	// the paths of the errors are relative to the protocol block. It is
+	// optional.
+	Validate func(protocol BaseProtocol) []ConfigError
+}
+
+// NewCollector returns a collector classifying the entries of the protocol.
+func (d Definition) NewCollector() collector.StatBase {
+	return collector.NewStatCollector(d.Classifier)
+}
+
+var (
+	registryLock sync.RWMutex
+	registry     = make(map[string]Definition)
+)
+
+// Register adds a protocol to the registry, usually from the init function of
+// the package implementing it. It panics if the definition is incomplete or
+// the name is already taken.
+func Register(def Definition) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if def.Name == "" || def.New == nil || def.Classifier == nil {
+		panic("protocols: Register needs a name, New and a Classifier")
+	}
+	if _, ok := registry[def.Name]; ok {
+		panic(fmt.Sprintf("protocols: Register called twice for %s", def.Name))
+	}
+	if def.Use == "" {
+		def.Use = def.Name
+	}
+	registry[def.Name] = def
+}
+
+// Lookup returns the definition of a registered protocol.
+func Lookup(name string) (Definition, bool) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	def, ok := registry[name]
+	return def, ok
+}
+
+// LookupProtocol returns the definition whose New returns protocols of the
+// same type as protocol.
+func LookupProtocol(protocol BaseProtocol) (Definition, bool) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	for _, def := range registry {
+		if reflect.TypeOf(def.New()) == reflect.TypeOf(protocol) {
+			return def, true
+		}
+	}
+	return Definition{}, false
+}
+
+// Registered returns the names of the registered protocols in sorted order.
+func Registered() []string {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,53 @@
+package protocols
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/BatikanHyt/netbench/pkg/collector"
+)
+
+// Replay recomputes the statistics of a past run from its raw log and reports
+// them like a live run, using the precision, interval and output settings of
+// the runner.
+func (r *Runner) Replay(path string) error {
+	reader, err := collector.OpenRawLog(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	def, ok := Lookup(reader.Header.Protocol)
+	if !ok {
+		return fmt.Errorf("unsupported protocol: %s", reader.Header.Protocol)
+	}
+	r.ProtocolName = reader.Header.Protocol
+	r.Concurency = reader.Header.Concurency
+	r.Rate = reader.Header.Rate
+	r.StatCollector = def.NewCollector()
+	interval, _ := time.ParseDuration(r.Interval)
+	r.StatCollector.SetOptions(collector.Options{
+		Precision: r.Precision,
+		Interval:  interval,
+		Start:     reader.Header.Start,
+	})
+
+	var cwg sync.WaitGroup
+	cwg.Add(1)
+	go r.StatCollector.Consume(&cwg)
+	err = reader.Replay(r.StatCollector)
+	r.StatCollector.Finished()
+	cwg.Wait()
+	if err != nil {
+		return err
+	}
+	if trailer := reader.Trailer; trailer != nil {
+		r.Dropped = trailer.Dropped
+		r.Interrupted = trailer.Interrupted
+	} else {
+		// the run never finished
+		r.Interrupted = true
+	}
+	r.finish()
+	return nil
+}
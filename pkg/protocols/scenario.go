@@ -0,0 +1,178 @@
+package protocols
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BatikanHyt/netbench/pkg/collector"
+	"github.com/BatikanHyt/netbench/pkg/helpers"
+)
+
+// Scenario is a named part of a mixed load. It has its own protocol and load
+// settings and runs in parallel with the other scenarios of the config.
+// Settings a scenario leaves out are inherited from the top of the config,
+// the output settings only exist for the whole run and raw logs only per
+// scenario.
+type Scenario struct {
+	Name       string
+	StartAfter string // offset from the start of the run, 0s by default
+	Runner     *Runner
+	keys       map[string]bool // settings set by the scenario itself
+}
+
+// inheritedKeys are the settings a scenario inherits from the top of the
+// config.
+var inheritedKeys = []string{
+	"concurency", "totalRequest", "duration", "rate", "precision", "interval",
+	"stages", "stageTarget", "stageMode", "rawLogFormat", "drainTimeout", "timeout",
+}
+
+// decodeScenarios decodes the validated scenarios of a config on top of
+// runners inheriting the settings of r.
+func (r *Runner) decodeScenarios(value interface{}) error {
+	r.Scenarios = nil
+	for _, item := range value.([]interface{}) {
+		v := item.(map[string]interface{})
+		scenario := &Scenario{
+			Name:       v["name"].(string),
+			StartAfter: "0s",
+			Runner:     r.scenarioRunner(),
+			keys:       make(map[string]bool, len(v)),
+		}
+		for key := range v {
+			scenario.keys[key] = true
+		}
+		if startAfter, ok := v["startAfter"].(string); ok {
+			scenario.StartAfter = startAfter
+		}
+		if err := scenario.Runner.decode(v); err != nil {
+			return fmt.Errorf("Scenario %s: %s", scenario.Name, err)
+		}
+		r.Scenarios = append(r.Scenarios, scenario)
+	}
+	return nil
+}
+
+// scenarioRunner returns a runner with the load settings of r.
+func (r *Runner) scenarioRunner() *Runner {
+	runner := &Runner{Quiet: r.Quiet}
+	for _, key := range inheritedKeys {
+		runner.inherit(r, key)
+	}
+	return runner
+}
+
+// inherit sets the setting key of r from the one of parent.
+func (r *Runner) inherit(parent *Runner, key string) {
+	switch key {
+	case "concurency":
+		r.Concurency = parent.Concurency
+	case "totalRequest":
+		r.TotalRequest = parent.TotalRequest
+	case "duration":
+		r.Duration = parent.Duration
+	case "rate":
+		r.Rate = parent.Rate
+	case "precision":
+		r.Precision = parent.Precision
+	case "interval":
+		r.Interval = parent.Interval
+	case "stages":
+		r.Stages = parent.Stages
+	case "stageTarget":
+		r.StageTarget = parent.StageTarget
+	case "stageMode":
+		r.StageMode = parent.StageMode
+	case "rawLogFormat":
+		r.RawLogFormat = parent.RawLogFormat
+	case "drainTimeout":
+		r.DrainTimeout = parent.DrainTimeout
+	case "timeout":
+		r.Timeout = parent.Timeout
+	}
+}
+
+// InheritSettings passes the settings named by keys, e.g. duration, on to
+// the scenarios that do not set them. Scenarios inherit once the config is
+// decoded, settings changed later, like flags overriding the config file,
+// have to be passed on again.
+func (r *Runner) InheritSettings(keys []string) error {
+	for _, scenario := range r.Scenarios {
+		for _, key := range keys {
+			if !scenario.keys[key] {
+				scenario.Runner.inherit(r, key)
+			}
+		}
+		if err := scenario.Runner.ValidateStages(); err != nil {
+			return fmt.Errorf("Scenario %s: %s", scenario.Name, err)
+		}
+	}
+	return nil
+}
+
+// executeScenarios runs every scenario from its start offset on and merges
+// their statistics into the collector of r. A scenario failing to start
+// stops the others.
+func (r *Runner) executeScenarios(ctx context.Context) error {
+	if r.RawLog != "" {
+		return errors.New("Raw logs are set per scenario")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	start := time.Now()
+	errs := make([]error, len(r.Scenarios))
+	var wg sync.WaitGroup
+	for i, scenario := range r.Scenarios {
+		wg.Add(1)
+		go func(i int, scenario *Scenario) {
+			defer wg.Done()
+			offset, _ := time.ParseDuration(scenario.StartAfter)
+			if !sleepUntil(ctx, start.Add(offset)) {
+				scenario.Runner.Interrupted = true
+				return
+			}
+			if err := scenario.Runner.execute(ctx); err != nil {
+				errs[i] = fmt.Errorf("Scenario %s: %s", scenario.Name, err)
+				cancel()
+			}
+		}(i, scenario)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	var collectors []*collector.StatCollector
+	var names []string
+	r.Dropped = 0
+	r.Interrupted = false
+	for _, scenario := range r.Scenarios {
+		if c, ok := scenario.Runner.StatCollector.(*collector.StatCollector); ok {
+			collectors = append(collectors, c)
+		}
+		if !helpers.Contains(names, scenario.Runner.ProtocolName) {
+			names = append(names, scenario.Runner.ProtocolName)
+		}
+		r.Dropped += scenario.Runner.Dropped
+		r.Interrupted = r.Interrupted || scenario.Runner.Interrupted
+	}
+	r.ProtocolName = strings.Join(names, "+")
+	r.StatCollector = collector.Merge(start, collectors...)
+	return nil
+}
+
+// printScenarios prints the result of every scenario ahead of the combined
+// one.
+func (r *Runner) printScenarios() {
+	for _, scenario := range r.Scenarios {
+		fmt.Printf("\nScenario %s (%s):", scenario.Name, scenario.Runner.ProtocolName)
+		scenario.Runner.printFinalResult()
+	}
+	fmt.Printf("\nCombined (%s):", r.ProtocolName)
+}
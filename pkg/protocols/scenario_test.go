@@ -0,0 +1,40 @@
+package protocols
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestInheritSettings(t *testing.T) {
+	config := `{
+		"duration": "1s",
+		"concurency": 2,
+		"scenarios": [
+			{"name": "inherits", "http": {"url": "http://127.0.0.1:8989/"}},
+			{"name": "own", "duration": "5s", "concurency": 3, "http": {"url": "http://127.0.0.1:8989/"}}
+		]
+	}`
+	r := &Runner{}
+	if err := json.Unmarshal([]byte(config), r); err != nil {
+		t.Fatal(err)
+	}
+	// e.g. -d 3s -c 4 given on the command line
+	r.Duration, r.Concurency = "3s", 4
+	if err := r.InheritSettings([]string{"duration", "concurency"}); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]struct {
+		duration   string
+		concurency int
+	}{
+		"inherits": {"3s", 4},
+		"own":      {"5s", 3},
+	}
+	for _, scenario := range r.Scenarios {
+		w := want[scenario.Name]
+		if scenario.Runner.Duration != w.duration || scenario.Runner.Concurency != w.concurency {
+			t.Errorf("scenario %s has duration %s and concurency %d, want %s and %d", scenario.Name,
+				scenario.Runner.Duration, scenario.Runner.Concurency, w.duration, w.concurency)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package protocols
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/BatikanHyt/netbench/pkg/collector"
+)
+
+// Search describes a capacity search: the open-loop rate is raised until the
+// SLO is violated, then bisected between the highest passing and the lowest
+// failing rate.
+type Search struct {
+	Percentile   float64       // response time percentile checked against MaxLatency
+	MaxLatency   time.Duration // 0 disables the latency SLO
+	MaxErrorRate float64       // highest accepted share of failed or dropped requests, 0-1
+	MinRate      float64
+	MaxRate      float64
+	StepDuration time.Duration
+	Tolerance    float64 // stop once the search window is narrower than this share of the rate
+	MaxSteps     int
+}
+
+// SearchStep is the outcome of running the benchmark at a single rate.
+type SearchStep struct {
+	Rate      float64
+	Passed    bool
+	Reason    string
+	ErrorRate float64
+	Latency   time.Duration
+	Dropped   int64
+	Stats     collector.GlobalStatistic
+}
+
+// Search runs one open-loop step per probed rate and returns the highest rate
+// that met the SLO (0 if none did) together with every step.
+func (r *Runner) Search(s *Search) (float64, []SearchStep) {
+	var steps []SearchStep
+	if len(r.Scenarios) > 0 {
+		fmt.Printf("Unable to search, scenarios are not supported\n")
+		return 0, steps
+	}
+	if r.Protocol == nil {
+		return 0, steps
+	}
+	def, ok := Lookup(r.ProtocolName)
+	if !ok {
+		fmt.Printf("Unable to search, unknown protocol %q\n", r.ProtocolName)
+		return 0, steps
+	}
+
+	ctx, release := trapInterrupt()
+	defer release()
+	best, failed := 0.0, 0.0
+	rate := s.MinRate
+	for i := 0; i < s.MaxSteps; i++ {
+		step := *r
+		step.Rate = rate
+		step.Duration = s.StepDuration.String()
+		step.Stages = nil
+		step.Dropped = 0
+		step.StatCollector = def.NewCollector()
+		if err := step.execute(ctx); err != nil {
+			fmt.Printf("Unable to run step %d: %s\n", i+1, err)
+			break
+		}
+		if step.Interrupted {
+			// a partial step says nothing about the rate
+			fmt.Printf("Search interrupted during step %d at rate %.2f req/s\n", i+1, rate)
+			break
+		}
+
+		result := s.evaluate(rate, &step)
+		steps = append(steps, result)
+		status := "PASS"
+		if !result.Passed {
+			status = "FAIL " + result.Reason
+		}
+		fmt.Printf("Step %d: rate %.2f req/s, p%v %s, errors %.2f%%, dropped %d -> %s\n",
+			i+1, rate, s.Percentile, result.Latency, result.ErrorRate*100, result.Dropped, status)
+
+		if result.Passed {
+			best = rate
+			if failed == 0 {
+				if rate >= s.MaxRate {
+					break
+				}
+				rate = rate * 2
+				if rate > s.MaxRate {
+					rate = s.MaxRate
+				}
+				continue
+			}
+		} else {
+			failed = rate
+			if best == 0 {
+				// even the lowest rate violates the SLO
+				break
+			}
+		}
+		if (failed-best)/failed <= s.Tolerance {
+			break
+		}
+		rate = (best + failed) / 2
+	}
+	return best, steps
+}
+
+func (s *Search) evaluate(rate float64, step *Runner) SearchStep {
+	stats := step.StatCollector.GetGlobalStats()
+	result := SearchStep{
+		Rate:    rate,
+		Passed:  true,
+		Dropped: step.Dropped,
+		Stats:   *stats,
+	}
+	attempts := int64(stats.TotalRequest) + step.Dropped
+	if attempts > 0 {
+		result.ErrorRate = float64(int64(stats.FailedReq)+step.Dropped) / float64(attempts)
+	}
+	result.Latency, _ = stats.ResponseTime.Percentile(s.Percentile)
+
+	if attempts == 0 {
+		result.Passed = false
+		result.Reason = "no requests sent"
+	} else if result.ErrorRate > s.MaxErrorRate {
+		result.Passed = false
+		result.Reason = fmt.Sprintf("error rate %.2f%% > %.2f%%", result.ErrorRate*100, s.MaxErrorRate*100)
+	} else if s.MaxLatency > 0 && result.Latency > s.MaxLatency {
+		result.Passed = false
+		result.Reason = fmt.Sprintf("p%v %s > %s", s.Percentile, result.Latency, s.MaxLatency)
+	}
+	return result
+}
+
+// PrintSearchResult prints the per-step statistics of a finished search.
+func PrintSearchResult(best float64, steps []SearchStep) {
+	fmt.Printf("\n%-12s %-8s %-10s %-10s %-14s %-14s %-14s\n", "Rate", "Result", "Requests", "Errors", "Avg", "p99", "Max")
+	for _, step := range steps {
+		result := "PASS"
+		if !step.Passed {
+			result = "FAIL"
+		}
+		fmt.Printf("%-12.2f %-8s %-10d %-10.2f %-14s %-14s %-14s\n", step.Rate, result, step.Stats.TotalRequest,
+			step.ErrorRate*100, step.Stats.ResponseTime.Mean, step.Stats.ResponseTime.P99, step.Stats.ResponseTime.Max)
+	}
+	if best == 0 {
+		fmt.Println("\nNo probed rate met the SLO")
+		return
+	}
+	fmt.Printf("\nHighest passing rate: %.2f req/s\n", best)
+}
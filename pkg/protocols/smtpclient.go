@@ -7,6 +7,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"mime/multipart"
 	"net"
@@ -14,15 +15,29 @@ import (
 	"net/mail"
 	"net/smtp"
 	"net/textproto"
-	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/BatikanHyt/netbench/pkg/collector"
+	"github.com/BatikanHyt/netbench/pkg/helpers"
+	"github.com/spf13/pflag"
 )
 
-type smtpClient struct {
+func init() {
+	Register(Definition{
+		Name:       "smtp",
+		Use:        "smtp [server_name:port]",
+		Short:      "Benchmark an smtp server",
+		New:        func() BaseProtocol { return NewSmtpClient() },
+		Classifier: collector.SmtpClassifier{},
+		BindFlags:  bindSmtpFlags,
+		Args:       smtpArgs,
+		Validate:   validateSmtp,
+	})
+}
+
+type SmtpClient struct {
 	Address string `json:"address"`
 	Tls     bool   `json:"tls"`
 	Auth    struct {
@@ -42,22 +57,143 @@ type smtpClient struct {
 	BodyHtml    string            `json:"body_html"`
 	Attachments []string          `json:"attachments"`
 	Timeout     time.Duration     `json:"Timeout"`
-	ReportChan  chan *collector.SmtpEntry
+	Vars        map[string]string `json:"vars"` // available to the templates as .Vars
+	Feeder      Feeder            `json:"feeder"`
+	stat        collector.StatBase
 	initialized bool
-	readSize    int64
-	writeSize   int64
 	Connection  *net.Conn
-	data        []byte
+	data        []byte // the mail, without the From, To and Subject headers unless read from an eml file
+	templates   *smtpTemplates
 }
 
-func NewSmtpClient() *smtpClient {
-	client := &smtpClient{
+func NewSmtpClient() *SmtpClient {
+	client := &SmtpClient{
 		initialized: false,
 	}
 
 	return client
 }
 
+func bindSmtpFlags(flags *pflag.FlagSet, protocol BaseProtocol) {
+	client := protocol.(*SmtpClient)
+	flags.StringVarP(&client.From, "from", "f", "", "STMP FROM (required)")
+	flags.StringArrayVarP(&client.To, "to", "t", nil, "SMTP to list (required)")
+	flags.StringVarP(&client.Subject, "subject", "s", "", "Mail subject (required)")
+
+	flags.StringArrayVar(&client.BCC, "bcc", nil, "SMTP BCC list")
+	flags.StringArrayVar(&client.CC, "cc", nil, "SMTP CC list")
+
+	flags.BoolVar(&client.Tls, "tls", false, "Use TLS")
+	flags.StringVarP(&client.Auth.Username, "username", "u", "", "Auth username")
+	flags.StringVarP(&client.Auth.Password, "password", "p", "", "Auth password")
+	flags.StringVarP(&client.Auth.Method, "method", "m", "", "Auth method (CRAM, PLAIN)")
+	flags.StringVarP(&client.EmlFile, "eml", "e", "", "Create mail from eml file")
+	flags.StringVarP(&client.Body, "body", "b", "", "SMTP text body")
+	flags.StringVar(&client.BodyHtml, "bodyhtml", "", "SMTP html body")
+	flags.StringVar(&client.BodyFile, "bodyfile", "", "Generate smtp body from file")
+	flags.StringToStringVarP(&client.Headers, "headers", "H", nil, "Headers in key=value format and comma(,) separated")
+	flags.StringArrayVar(&client.Attachments, "attachment", nil, "List of attachments")
+	flags.StringToStringVar(&client.Vars, "var", map[string]string{}, "Template variables in key=value format and comma(,) separated, used as {{.Vars.key}}")
+	bindFeederFlags(flags, &client.Feeder)
+}
+
+var validAuths = []string{"PLAIN", "CRAM"}
+
+func smtpArgs(protocol BaseProtocol, args []string) error {
+	client := protocol.(*SmtpClient)
+	if len(args) > 0 {
+		client.Address = args[0]
+	}
+	if client.Address == "" {
+		return errors.New("Needto define STMP server")
+	}
+	if errs := validateSmtp(client); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// validateSmtp checks the address and the envelope, From, To and Subject
+// are read from the eml file when one is given. Templated addresses are
+// checked once rendered.
+func validateSmtp(protocol BaseProtocol) []ConfigError {
+	client := protocol.(*SmtpClient)
+	var errs []ConfigError
+	errs = append(errs, validateFeeder(&client.Feeder)...)
+	templates, tErrs := client.parseTemplates()
+	errs = append(errs, tErrs...)
+	sample, sErrs := client.Feeder.sampleData()
+	errs = append(errs, sErrs...)
+	from, to := client.From, client.To
+	failed := make(map[string]bool)
+	if templates != nil && len(sErrs) == 0 {
+		data := &TemplateData{Vars: client.Vars, Data: sample}
+		var err error
+		if from, err = templates.from.execute(data); err != nil {
+			errs = append(errs, ConfigError{"from", err.Error()})
+			failed["from"] = true
+		}
+		to = make([]string, len(templates.to))
+		for i, tmpl := range templates.to {
+			if to[i], err = tmpl.execute(data); err != nil {
+				errs = append(errs, ConfigError{fmt.Sprintf("to[%d]", i), err.Error()})
+				failed[fmt.Sprintf("to[%d]", i)] = true
+			}
+		}
+		if _, err := templates.subject.execute(data); err != nil {
+			errs = append(errs, ConfigError{"subject", err.Error()})
+		}
+	} else {
+		// templates that could not be rendered have their error already
+		failed["from"] = strings.Contains(from, "{{")
+		for i, addr := range to {
+			failed[fmt.Sprintf("to[%d]", i)] = strings.Contains(addr, "{{")
+		}
+	}
+	if client.Address == "" {
+		errs = append(errs, ConfigError{"address", "Missing required field"})
+	} else if host, port, err := net.SplitHostPort(client.Address); err != nil || host == "" || port == "" {
+		errs = append(errs, ConfigError{"address", fmt.Sprintf("Invalid address format %q, <ip>:<port>", client.Address)})
+	}
+	if client.EmlFile == "" {
+		if client.From == "" {
+			errs = append(errs, ConfigError{"from", "Missing required field"})
+		}
+		if len(client.To) == 0 {
+			errs = append(errs, ConfigError{"to", "Missing required field"})
+		}
+		if client.Subject == "" {
+			errs = append(errs, ConfigError{"subject", "Missing required field"})
+		}
+	}
+	if client.From != "" && !failed["from"] {
+		if _, err := mail.ParseAddress(from); err != nil {
+			errs = append(errs, ConfigError{"from", fmt.Sprintf("Invalid address %q: %s", from, err)})
+		}
+	}
+	for _, list := range []struct {
+		key   string
+		addrs []string
+	}{{"to", to}, {"cc", client.CC}, {"bcc", client.BCC}} {
+		for i, addr := range list.addrs {
+			key := fmt.Sprintf("%s[%d]", list.key, i)
+			if failed[key] {
+				continue
+			}
+			if _, err := mail.ParseAddress(addr); err != nil {
+				errs = append(errs, ConfigError{key, fmt.Sprintf("Invalid address %q: %s", addr, err)})
+			}
+		}
+	}
+	if client.Auth.Method != "" && !helpers.Contains(validAuths, client.Auth.Method) {
+		errs = append(errs, ConfigError{"auth.method", fmt.Sprintf("Invalid Auth method %s. Valid auth methods %v", client.Auth.Method, validAuths)})
+	}
+	if client.Auth.Method != "" && client.Auth.Username == "" {
+		errs = append(errs, ConfigError{"auth.username", "Missing required field"})
+	}
+	return errs
+}
+
 func writePlainBodyPart(writer *bytes.Buffer, content []byte, is_multi bool, boundary *string) {
 	if is_multi {
 		writer.WriteString(fmt.Sprintf("--%s\n", *boundary))
@@ -101,9 +237,45 @@ func writeAttachmentPart(writer *bytes.Buffer, attachments []string, boundary *s
 	}
 }
 
-func (c *smtpClient) Initialize(clc *collector.StatBase) {
-	sclc, _ := (*clc).(*collector.SmtpStatCollector)
-	c.ReportChan = sclc.StatChannel
+// smtpTemplates are the parts of a mail evaluated per mail.
+type smtpTemplates struct {
+	from    *requestTemplate
+	to      []*requestTemplate
+	subject *requestTemplate
+}
+
+// smtpMail is the envelope and the content of a single mail.
+type smtpMail struct {
+	from    string
+	to      []string
+	content []byte
+}
+
+// parseTemplates parses From, every To and Subject.
+func (c *SmtpClient) parseTemplates() (*smtpTemplates, []ConfigError) {
+	var errs []ConfigError
+	funcs := templateFuncs()
+	templates := &smtpTemplates{to: make([]*requestTemplate, len(c.To))}
+	var err error
+	if templates.from, err = newRequestTemplate("from", c.From, funcs); err != nil {
+		errs = append(errs, ConfigError{"from", err.Error()})
+	}
+	for i, to := range c.To {
+		if templates.to[i], err = newRequestTemplate("to", to, funcs); err != nil {
+			errs = append(errs, ConfigError{fmt.Sprintf("to[%d]", i), err.Error()})
+		}
+	}
+	if templates.subject, err = newRequestTemplate("subject", c.Subject, funcs); err != nil {
+		errs = append(errs, ConfigError{"subject", err.Error()})
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return templates, nil
+}
+
+func (c *SmtpClient) Initialize(stat collector.StatBase) error {
+	c.stat = stat
 	var err error
 	if c.EmlFile != "" {
 		c.data, err = c.createMailFromEml()
@@ -111,13 +283,48 @@ func (c *smtpClient) Initialize(clc *collector.StatBase) {
 		c.data, err = c.createMailFromConf()
 	}
 	if err != nil {
-		fmt.Printf("Error: %s\n", err)
-		os.Exit(1)
+		return err
+	}
+	if c.EmlFile == "" {
+		templates, errs := c.parseTemplates()
+		if len(errs) > 0 {
+			return errs[0]
+		}
+		c.templates = templates
+	}
+	if err := c.Feeder.load(); err != nil {
+		return err
 	}
 	c.initialized = true
+	return nil
 }
 
-func (c *smtpClient) createMailFromEml() ([]byte, error) {
+// mail renders the envelope and the headers of a mail against data, mails
+// read from an eml file are sent as they are.
+func (c *SmtpClient) mail(data *TemplateData) (*smtpMail, error) {
+	if c.templates == nil {
+		return &smtpMail{from: c.From, to: c.To, content: c.data}, nil
+	}
+	m := &smtpMail{to: make([]string, len(c.templates.to))}
+	var err error
+	if m.from, err = c.templates.from.execute(data); err != nil {
+		return nil, err
+	}
+	for i, tmpl := range c.templates.to {
+		if m.to[i], err = tmpl.execute(data); err != nil {
+			return nil, err
+		}
+	}
+	subject, err := c.templates.subject.execute(data)
+	if err != nil {
+		return nil, err
+	}
+	header := fmt.Sprintf("From: %s\nTo: %s\nSubject: %s\n", m.from, strings.Join(m.to, ","), subject)
+	m.content = append([]byte(header), c.data...)
+	return m, nil
+}
+
+func (c *SmtpClient) createMailFromEml() ([]byte, error) {
 	emlfile, err := ioutil.ReadFile(c.EmlFile)
 	if err != nil {
 		return nil, err
@@ -159,16 +366,14 @@ func (c *smtpClient) createMailFromEml() ([]byte, error) {
 	return emlfile, nil
 }
 
-func (c *smtpClient) createMailFromConf() ([]byte, error) {
+func (c *SmtpClient) createMailFromConf() ([]byte, error) {
 	data := &bytes.Buffer{}
 
 	if c.From == "" || len(c.To) == 0 || c.Subject == "" {
 		return nil, errors.New("STMP requires From, To and Subject to be non empty")
 	}
 
-	data.WriteString(fmt.Sprintf("From: %s\n", c.From))
-	data.WriteString(fmt.Sprintf("To: %s\n", strings.Join(c.To, ",")))
-	data.WriteString(fmt.Sprintf("Subject: %s\n", c.Subject))
+	// From, To and Subject are added per mail
 	if len(c.CC) > 0 {
 		data.WriteString(fmt.Sprintf("Cc: %s\n", strings.Join(c.CC, ",")))
 	}
@@ -196,123 +401,225 @@ func (c *smtpClient) createMailFromConf() ([]byte, error) {
 	if c.BodyFile != "" {
 		content, err := ioutil.ReadFile(c.BodyFile)
 		if err != nil {
-			fmt.Printf("Error reading body %s \n", err)
-		} else {
-			writePlainBodyPart(data, content, multipart_alternative, &boundary)
+			return nil, fmt.Errorf("Unable to read body: %s", err)
 		}
+		writePlainBodyPart(data, content, multipart_alternative, &boundary)
 	} else {
 		writePlainBodyPart(data, []byte(c.Body), multipart_alternative, &boundary)
 	}
 	if c.BodyHtml != "" {
 		content, err := ioutil.ReadFile(c.BodyHtml)
 		if err != nil {
-			fmt.Printf("Error reading html body %s \n", err)
-		} else {
-			writeHtmlBodyPart(data, content, multipart_alternative, &boundary)
+			return nil, fmt.Errorf("Unable to read html body: %s", err)
 		}
+		writeHtmlBodyPart(data, content, multipart_alternative, &boundary)
 	}
 	writeAttachmentPart(data, c.Attachments, &boundary)
 	return data.Bytes(), nil
 }
 
+// getSmtpErrorCode returns the reply code of an SMTP error, 0 when the
+// server did not reply.
 func getSmtpErrorCode(err error) int {
-	if e, ok := err.(*textproto.Error); ok {
+	var e *textproto.Error
+	if errors.As(err, &e) {
 		return e.Code
 	}
-	return 1000
+	return 0
 }
 
-func (c *smtpClient) sendStat(code int, dur time.Duration) {
-	stat := &collector.SmtpEntry{
-		ResponseCode: code,
-		WriteSize:    c.writeSize,
-		ReadSize:     c.readSize,
-		Duration:     dur,
+// smtpSession is a single SMTP transaction. Every session dials its own
+// connection, so the connection counters hold the bytes of this session only.
+type smtpSession struct {
+	ctx     context.Context // context of the run
+	conn    *trackingConn
+	phases  []collector.Phase
+	sent    int64
+	unwatch func()
+	code    int                     // reply code reported for the session
+	err     *collector.RequestError // first failed command
+}
+
+// phase runs an SMTP command and records how long it took under name. The
+// first failing command gives the error and the reply code of the session.
+func (s *smtpSession) phase(name string, command func() error) error {
+	start := time.Now()
+	err := command()
+	s.phases = append(s.phases, collector.Phase{Name: name, Duration: time.Since(start)})
+	if err != nil && s.err == nil {
+		s.err = classifyError(s.ctx, err, name)
+		s.code = getSmtpErrorCode(err)
 	}
-	c.ReportChan <- stat
+	return err
 }
 
-func (c *smtpClient) StartBenchmark() {
+func (c *SmtpClient) sendStat(iter Iteration, start time.Time, session *smtpSession) {
+	entry := &collector.Entry{
+		Status:        session.code,
+		BodyWriteSize: session.sent,
+		Worker:        iter.Worker,
+		Scheduled:     iter.Scheduled,
+		Start:         start,
+		Duration:      time.Since(start),
+		Phases:        session.phases,
+		Error:         session.err,
+	}
+	if session.conn != nil {
+		entry.ReadSize, entry.WriteSize = session.conn.counters()
+	}
+	c.stat.Submit(entry)
+}
+
+func (c *SmtpClient) StartBenchmark(ctx context.Context, iter Iteration) {
 	if !c.initialized {
 		fmt.Println("SMTP not initialized correctly!")
 		return
 	}
+	row, ok := c.Feeder.row(iter)
+	if !ok {
+		iter.Stop()
+		return
+	}
 	start := time.Now()
-	code := 250
-	conn, err := c.initializeConnection()
+	session := &smtpSession{ctx: ctx, code: 250}
+	m, err := c.mail(&TemplateData{
+		Worker:    iter.Worker,
+		Iteration: iter.Seq,
+		Vars:      c.Vars,
+		Data:      row,
+	})
 	if err != nil {
-		code = getSmtpErrorCode(err)
-		elapsed := time.Since(start)
-		c.sendStat(code, elapsed)
-		fmt.Printf("Error initializing the connection")
+		session.code = 0
+		session.err = classifyError(ctx, err, "prepare")
+		c.sendStat(iter, start, session)
 		return
 	}
-	cc, err := conn.Data()
+	reqCtx, cancel := iter.context(ctx)
+	c.runSession(reqCtx, session, m)
+	if session.unwatch != nil {
+		session.unwatch()
+	}
+	cancel()
+	if session.conn != nil {
+		session.conn.Close()
+	}
+	c.sendStat(iter, start, session)
+}
+
+// watchContext interrupts the blocking calls on conn once ctx is done, since
+// net/smtp has no context support. The returned function stops watching.
+func watchContext(ctx context.Context, conn net.Conn) func() {
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+	return func() { close(stop) }
+}
+
+func (c *SmtpClient) runSession(ctx context.Context, session *smtpSession, m *smtpMail) {
+	conn, err := c.initializeConnection(ctx, session, m)
 	if err != nil {
-		code = getSmtpErrorCode(err)
-		elapsed := time.Since(start)
-		c.sendStat(code, elapsed)
-		fmt.Printf("Error data %s\n", err)
 		return
 	}
-	cc.Write(c.data)
-	cc.Close()
-
-	err = conn.Quit()
+	var cc io.WriteCloser
+	// DATA ends with the 354 reply, data_end with the reply to the final dot
+	// which includes the content scanning of the server
+	err = session.phase("data", func() (err error) {
+		cc, err = conn.Data()
+		return err
+	})
 	if err != nil {
-		code = getSmtpErrorCode(err)
+		return
 	}
-
-	elapsed := time.Since(start)
-	c.sendStat(code, elapsed)
+	err = session.phase("data_end", func() error {
+		sent, err := cc.Write(m.content)
+		session.sent = int64(sent)
+		if err != nil {
+			return err
+		}
+		return cc.Close()
+	})
+	if err != nil {
+		return
+	}
+	session.phase("quit", conn.Quit)
 }
 
-func (c *smtpClient) initializeConnection() (*smtp.Client, error) {
-	ctx := context.Background()
-	conT, err := DialContextWithBytesTracked(ctx, "tcp", c.Address, &c.readSize, &c.writeSize)
+func (c *SmtpClient) initializeConnection(ctx context.Context, session *smtpSession, m *smtpMail) (*smtp.Client, error) {
+	var conT net.Conn
+	err := session.phase("connect", func() (err error) {
+		conT, err = DialContextWithBytesTracked(ctx, "tcp", c.Address)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	session.conn = trackedConn(conT)
+	session.unwatch = watchContext(ctx, conT)
+	var conn *smtp.Client
+	// NewClient returns once the greeting banner is read
+	err = session.phase("banner", func() (err error) {
+		conn, err = smtp.NewClient(conT, c.Address)
+		return err
+	})
 	if err != nil {
-		fmt.Printf("Error dial context: %s\n", err)
 		return nil, err
 	}
-	conn, err := smtp.NewClient(conT, c.Address)
+	// EHLO is sent explicitly, otherwise the first command would include it
+	err = session.phase("ehlo", func() error {
+		return conn.Hello("localhost")
+	})
 	if err != nil {
-		fmt.Printf("Error initializng smtp client. Error: %s\n", err)
 		return nil, err
 	}
 	if c.Tls {
-		conn.StartTLS(&tls.Config{
-			InsecureSkipVerify: true,
+		err = session.phase("starttls", func() error {
+			return conn.StartTLS(&tls.Config{
+				InsecureSkipVerify: true,
+			})
 		})
+		if err != nil {
+			return nil, err
+		}
 	}
 
+	var auth smtp.Auth
 	switch c.Auth.Method {
 	case "CRAM":
-		auth := smtp.CRAMMD5Auth(c.Auth.Username, c.Auth.Password)
-		err := conn.Auth(auth)
-		if err != nil {
-			fmt.Printf("Error in auth: %s \n", err)
-			return nil, err
-		}
+		auth = smtp.CRAMMD5Auth(c.Auth.Username, c.Auth.Password)
 	case "PLAIN":
-		auth := smtp.PlainAuth("", c.Auth.Username, c.Auth.Password, c.Address)
-		err := conn.Auth(auth)
+		auth = smtp.PlainAuth("", c.Auth.Username, c.Auth.Password, c.Address)
+	}
+	if auth != nil {
+		err = session.phase("auth", func() error {
+			return conn.Auth(auth)
+		})
 		if err != nil {
-			fmt.Printf("Error in auth: %s \n", err)
 			return nil, err
 		}
 	}
-	conn.Mail(c.From)
+	err = session.phase("mail", func() error {
+		return conn.Mail(m.from)
+	})
+	if err != nil {
+		return nil, err
+	}
 	uniq_recp := make(map[string]bool)
-	for _, arr := range [][]string{c.To, c.CC, c.BCC} {
+	for _, arr := range [][]string{m.to, c.CC, c.BCC} {
 		for _, elem := range arr {
 			uniq_recp[elem] = true
 		}
 	}
+	// a rejected recipient fails the session, the mail is still sent to the
+	// accepted ones
 	for key := range uniq_recp {
-		err := conn.Rcpt(key)
-		if err != nil {
-			fmt.Printf("Error adding recepient %s \n", err)
-		}
+		session.phase("rcpt", func() error {
+			return conn.Rcpt(key)
+		})
 	}
 
 	return conn, nil
@@ -0,0 +1,215 @@
+package protocols
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BatikanHyt/netbench/pkg/helpers"
+)
+
+// Stage moves the load from the target of the previous stage (zero for the
+// first one) to Target within Duration. Depending on the runner's StageTarget
+// the target is a number of workers or an arrival rate in requests/sec.
+type Stage struct {
+	Duration string  `json:"duration"`
+	Target   float64 `json:"target"`
+}
+
+const (
+	StageTargetWorkers = "workers"
+	StageTargetRate    = "rate"
+	StageModeRamp      = "ramp" // linear change over the stage duration
+	StageModeStep      = "step" // jump to the target when the stage starts
+)
+
+var ValidStageTargets = []string{StageTargetWorkers, StageTargetRate}
+var ValidStageModes = []string{StageModeRamp, StageModeStep}
+
+// how often the worker count is adjusted, and how long the scheduler waits
+// while the arrival rate is zero
+const stageTick = 100 * time.Millisecond
+
+// ParseStages parses stages in duration:target format, e.g. "30s:200".
+func ParseStages(specs []string) ([]Stage, error) {
+	stages := make([]Stage, 0, len(specs))
+	for _, spec := range specs {
+		parts := strings.Split(spec, ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid stage %q, expected duration:target", spec)
+		}
+		target, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid stage target %q: %s", parts[1], err)
+		}
+		stages = append(stages, Stage{Duration: parts[0], Target: target})
+	}
+	return stages, checkStages(stages)
+}
+
+func checkStages(stages []Stage) error {
+	for _, stage := range stages {
+		if _, err := time.ParseDuration(stage.Duration); err != nil {
+			return fmt.Errorf("Invalid stage duration %q: %s", stage.Duration, err)
+		}
+		if stage.Target < 0 {
+			return fmt.Errorf("Stage target cannot be negative: %v", stage.Target)
+		}
+	}
+	return nil
+}
+
+// stagesDuration returns the total length of the load profile.
+func (r *Runner) stagesDuration() time.Duration {
+	var total time.Duration
+	for _, stage := range r.Stages {
+		d, _ := time.ParseDuration(stage.Duration)
+		total += d
+	}
+	return total
+}
+
+// stageLoad returns the target load at the given point of the profile and
+// false once every stage is over.
+func (r *Runner) stageLoad(elapsed time.Duration) (float64, bool) {
+	from := 0.0
+	for _, stage := range r.Stages {
+		d, _ := time.ParseDuration(stage.Duration)
+		if elapsed < d {
+			if r.StageMode == StageModeStep {
+				return stage.Target, true
+			}
+			return from + (stage.Target-from)*float64(elapsed)/float64(d), true
+		}
+		elapsed -= d
+		from = stage.Target
+	}
+	return 0, false
+}
+
+func (r *Runner) runStages(ctx context.Context, runCtx context.Context, wg *sync.WaitGroup, pool chan int) {
+	if r.StageTarget == StageTargetRate {
+		r.runRateStages(ctx, runCtx, wg, pool)
+	} else {
+		r.runWorkerStages(ctx, runCtx, wg)
+	}
+}
+
+// runWorkerStages keeps as many closed-loop workers running as the current
+// stage asks for, each of them sending requests back to back.
+func (r *Runner) runWorkerStages(ctx context.Context, runCtx context.Context, wg *sync.WaitGroup) {
+	total := r.stagesDuration()
+	printProgress := total > progressTimeThreshold
+	nextProgress := 1
+	var workers []chan struct{}
+	ticker := time.NewTicker(stageTick)
+	defer ticker.Stop()
+	start := time.Now()
+stages:
+	for {
+		elapsed := time.Since(start)
+		load, running := r.stageLoad(elapsed)
+		if !running {
+			break
+		}
+		want := int(math.Round(load))
+		for len(workers) < want {
+			quit := make(chan struct{})
+			workers = append(workers, quit)
+			wg.Add(1)
+			go r.worker(ctx, runCtx, wg, len(workers)-1, quit)
+		}
+		for len(workers) > want {
+			close(workers[len(workers)-1])
+			workers = workers[:len(workers)-1]
+		}
+		if printProgress && r.progressReached(nextProgress, 0, total, elapsed) {
+			nextProgress++
+			r.printProgress()
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			break stages
+		}
+	}
+	for _, quit := range workers {
+		close(quit)
+	}
+}
+
+// worker sends requests back to back until quit is closed, the run ends or
+// ctx is done, e.g. once a feeder in stop mode is exhausted.
+func (r *Runner) worker(ctx context.Context, runCtx context.Context, wg *sync.WaitGroup, id int, quit chan struct{}) {
+	defer wg.Done()
+	for {
+		select {
+		case <-quit:
+			return
+		case <-runCtx.Done():
+			return
+		case <-ctx.Done():
+			return
+		default:
+			r.Protocol.StartBenchmark(runCtx, r.nextIteration(id, time.Now()))
+		}
+	}
+}
+
+// runRateStages is the open-loop counterpart of runWorkerStages, the time to
+// the next arrival follows the rate of the current stage.
+func (r *Runner) runRateStages(ctx context.Context, runCtx context.Context, wg *sync.WaitGroup, pool chan int) {
+	total := r.stagesDuration()
+	printProgress := total > progressTimeThreshold
+	nextProgress := 1
+	start := time.Now()
+	intended := start
+	credit := 0.0
+	for {
+		elapsed := intended.Sub(start)
+		rate, running := r.stageLoad(elapsed)
+		if !running {
+			break
+		}
+		if !sleepUntil(ctx, intended) {
+			break
+		}
+		if printProgress && r.progressReached(nextProgress, 0, total, elapsed) {
+			nextProgress++
+			r.printProgress()
+		}
+		if rate <= 0 {
+			intended = intended.Add(stageTick)
+			continue
+		}
+		interval := time.Duration(float64(time.Second) / rate)
+		if interval > stageTick {
+			// low rates are integrated tick by tick, so that a rising rate
+			// is picked up before a long interval expires
+			credit += float64(stageTick) / float64(interval)
+			if credit >= 1 {
+				credit--
+				r.dispatch(ctx, runCtx, wg, pool, intended)
+			}
+			intended = intended.Add(stageTick)
+			continue
+		}
+		r.dispatch(ctx, runCtx, wg, pool, intended)
+		intended = intended.Add(interval)
+	}
+}
+
+// ValidateStages checks the stage related settings of the runner.
+func (r *Runner) ValidateStages() error {
+	if r.StageTarget != "" && !helpers.Contains(ValidStageTargets, r.StageTarget) {
+		return fmt.Errorf("Invalid stage target %s. Valid targets: %v", r.StageTarget, ValidStageTargets)
+	}
+	if r.StageMode != "" && !helpers.Contains(ValidStageModes, r.StageMode) {
+		return fmt.Errorf("Invalid stage mode %s. Valid modes: %v", r.StageMode, ValidStageModes)
+	}
+	return checkStages(r.Stages)
+}
@@ -0,0 +1,55 @@
+package protocols
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/BatikanHyt/netbench/pkg/collector"
+)
+
+// stoppingProtocol stops the run on its limit-th call, like an exhausted
+// feeder in stop mode.
+type stoppingProtocol struct {
+	limit int64
+	calls int64
+}
+
+func (p *stoppingProtocol) Initialize(stat collector.StatBase) error {
+	return nil
+}
+
+func (p *stoppingProtocol) StartBenchmark(ctx context.Context, iter Iteration) {
+	if atomic.AddInt64(&p.calls, 1) >= p.limit {
+		iter.Stop()
+	}
+}
+
+func TestWorkerStagesStop(t *testing.T) {
+	protocol := &stoppingProtocol{limit: 10}
+	runner := &Runner{
+		Stages:       []Stage{{Duration: "2s", Target: 4}},
+		StageTarget:  StageTargetWorkers,
+		StageMode:    StageModeStep,
+		Timeout:      "0s",
+		DrainTimeout: DefaultDrainTimeout.String(),
+		Precision:    collector.DefaultPrecision,
+		Interval:     collector.DefaultInterval.String(),
+		Quiet:        true,
+	}
+	if err := runner.SetProtocol("http", protocol); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := runner.RunContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("run took %s after it was stopped", elapsed)
+	}
+	// every worker may finish the call it is in
+	if calls := atomic.LoadInt64(&protocol.calls); calls > protocol.limit+4 {
+		t.Errorf("got %d calls, want the workers to stop after %d", calls, protocol.limit)
+	}
+}
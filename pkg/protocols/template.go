@@ -0,0 +1,121 @@
+package protocols
+
+import (
+	crand "crypto/rand"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const templateLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// TemplateData is what a request template is evaluated against, e.g.
+// {{.Worker}}, {{.Iteration}}, {{.Vars.user}} or {{.Data.user}}.
+type TemplateData struct {
+	Worker    int               // slot of the worker sending the request
+	Iteration int64             // number of the request within the run, starting from 0
+	Vars      map[string]string // variables of the config or the command line
+	Data      map[string]string // row of the feeder
+}
+
+// requestTemplate is a part of a request evaluated for every request with
+// text/template. Values without actions are sent as they are.
+type requestTemplate struct {
+	text string
+	tmpl *template.Template
+}
+
+// newRequestTemplate parses text, funcs are the functions of the templates
+// of a single protocol so they share their counters.
+func newRequestTemplate(name string, text string, funcs template.FuncMap) (*requestTemplate, error) {
+	t := &requestTemplate{text: text}
+	if !strings.Contains(text, "{{") {
+		return t, nil
+	}
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid template: %s", strings.TrimPrefix(err.Error(), "template: "))
+	}
+	t.tmpl = tmpl
+	return t, nil
+}
+
+func (t *requestTemplate) execute(data *TemplateData) (string, error) {
+	if t.tmpl == nil {
+		return t.text, nil
+	}
+	var sb strings.Builder
+	if err := t.tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("Template failed: %s", strings.TrimPrefix(err.Error(), "template: "))
+	}
+	return sb.String(), nil
+}
+
+// templateFuncs returns the functions of the request templates:
+//
+//	randInt min max   random number in [min, max]
+//	randString n      random alphanumeric string of n characters
+//	uuid              random UUID (version 4)
+//	seq [name]        next value of a counter starting from 0, named
+//	                  counters count on their own
+//	now               time of the request, printed as 2006-01-02 15:04:05.999 -0700 MST,
+//	                  {{now.Unix}} gives a timestamp in seconds and
+//	                  {{now.Format "2006-01-02T15:04:05Z07:00"}} any layout
+func templateFuncs() template.FuncMap {
+	var lock sync.Mutex
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	counters := make(map[string]int64)
+	return template.FuncMap{
+		"randInt": func(min, max int) (int, error) {
+			if max < min {
+				return 0, fmt.Errorf("randInt max %d is less than min %d", max, min)
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			return min + random.Intn(max-min+1), nil
+		},
+		"randString": func(n int) string {
+			lock.Lock()
+			defer lock.Unlock()
+			b := make([]byte, n)
+			for i := range b {
+				b[i] = templateLetters[random.Intn(len(templateLetters))]
+			}
+			return string(b)
+		},
+		"uuid": func() (string, error) {
+			b := make([]byte, 16)
+			if _, err := crand.Read(b); err != nil {
+				return "", err
+			}
+			b[6] = b[6]&0x0f | 0x40
+			b[8] = b[8]&0x3f | 0x80
+			return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+		},
+		"seq": func(name ...string) int64 {
+			lock.Lock()
+			defer lock.Unlock()
+			key := strings.Join(name, ".")
+			value := counters[key]
+			counters[key]++
+			return value
+		},
+		"now": func() time.Time {
+			// without the monotonic clock reading, which String appends
+			return time.Now().Round(0)
+		},
+	}
+}
+
+func sortedKeys(v map[string]string) []string {
+	keys := make([]string, 0, len(v))
+	for key := range v {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,37 @@
+package protocols
+
+import (
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTemplateNow(t *testing.T) {
+	tests := []struct {
+		text string
+		want *regexp.Regexp
+	}{
+		{"{{now}}", regexp.MustCompile(`^\d{4}-\d\d-\d\d \d\d:\d\d:\d\d(\.\d+)? [+-]\d{4} \S+$`)},
+		{"{{now.Unix}}", regexp.MustCompile(`^\d+$`)},
+		{`{{now.Format "2006-01-02"}}`, regexp.MustCompile(`^\d{4}-\d\d-\d\d$`)},
+	}
+	for _, tt := range tests {
+		tmpl, err := newRequestTemplate("now", tt.text, templateFuncs())
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := tmpl.execute(&TemplateData{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !tt.want.MatchString(got) {
+			t.Errorf("%s = %q, want it to match %s", tt.text, got, tt.want)
+		}
+	}
+	tmpl, _ := newRequestTemplate("now", "{{now.Unix}}", templateFuncs())
+	got, _ := tmpl.execute(&TemplateData{})
+	if unix, _ := strconv.ParseInt(got, 10, 64); time.Since(time.Unix(unix, 0)) > time.Minute {
+		t.Errorf("{{now.Unix}} = %s, want the current time", got)
+	}
+}
@@ -0,0 +1,403 @@
+package protocols
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BatikanHyt/netbench/pkg/collector"
+	"github.com/BatikanHyt/netbench/pkg/helpers"
+	"github.com/BatikanHyt/netbench/pkg/report"
+)
+
+// ConfigError is a problem of a config at a JSON path, e.g. $.http.method.
+type ConfigError struct {
+	Path    string
+	Message string
+}
+
+func (e ConfigError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// ConfigErrors are all the problems found in a config, one per line.
+type ConfigErrors []ConfigError
+
+func (e ConfigErrors) Error() string {
+	lines := make([]string, 0, len(e))
+	for _, err := range e {
+		lines = append(lines, err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// runnerKeys are the settings of a config by the type of their value.
+var runnerKeys = map[string]reflect.Type{
+	"concurency":   reflect.TypeOf(0),
+	"totalRequest": reflect.TypeOf(0),
+	"duration":     reflect.TypeOf(""),
+	"rate":         reflect.TypeOf(0.0),
+	"precision":    reflect.TypeOf(0),
+	"interval":     reflect.TypeOf(""),
+	"rawLog":       reflect.TypeOf(""),
+	"rawLogFormat": reflect.TypeOf(""),
+	"stages":       reflect.TypeOf([]Stage{}),
+	"stageTarget":  reflect.TypeOf(""),
+	"stageMode":    reflect.TypeOf(""),
+	"output":       reflect.TypeOf(""),
+	"outputFile":   reflect.TypeOf(""),
+	"timeout":      reflect.TypeOf(""),
+	"drainTimeout": reflect.TypeOf(""),
+}
+
+// scenarioOnlyKeys are only valid in a scenario, runOnlyKeys only at the top
+// of a config.
+var (
+	scenarioOnlyKeys = []string{"name", "startAfter"}
+	runOnlyKeys      = []string{"scenarios", "output", "outputFile"}
+)
+
+// ValidateConfig checks a JSON config without running it. The returned error
+// is a ConfigErrors listing every problem found.
+func ValidateConfig(data []byte) error {
+	var v map[string]interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("Invalid JSON: %s", err)
+	}
+	if errs := validateRunner(v); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateRunner(v map[string]interface{}) ConfigErrors {
+	c := &configValidator{}
+	c.runner("$", v, false)
+	sort.SliceStable(c.errs, func(i, j int) bool {
+		return c.errs[i].Path < c.errs[j].Path
+	})
+	return c.errs
+}
+
+// configValidator collects the problems of a decoded config.
+type configValidator struct {
+	errs ConfigErrors
+}
+
+func (c *configValidator) add(path string, format string, args ...interface{}) {
+	c.errs = append(c.errs, ConfigError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func sortedConfigKeys(v map[string]interface{}) []string {
+	keys := make([]string, 0, len(v))
+	for key := range v {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// runner checks the settings and the protocol or the scenarios of a config,
+// scenario tells whether v is a scenario of a config.
+func (c *configValidator) runner(path string, v map[string]interface{}, scenario bool) {
+	var protocols []string
+	for _, key := range sortedConfigKeys(v) {
+		value := v[key]
+		keyPath := path + "." + key
+		if t, ok := runnerKeys[key]; ok {
+			if c.value(keyPath, value, t) && value != nil {
+				c.setting(keyPath, key, value)
+			}
+		} else if helpers.Contains(scenarioOnlyKeys, key) {
+			if !scenario {
+				c.add(keyPath, "Only valid in a scenario")
+			}
+		} else if key == "scenarios" {
+			if !scenario {
+				c.scenarios(keyPath, value)
+			}
+		} else if def, ok := Lookup(key); ok {
+			protocols = append(protocols, key)
+			c.protocol(keyPath, def, value)
+		} else {
+			c.add(keyPath, "Unknown key, expected a setting or one of the protocols %v", Registered())
+		}
+		if scenario && helpers.Contains(runOnlyKeys, key) {
+			c.add(keyPath, "Cannot be set in a scenario")
+		}
+	}
+
+	if v["totalRequest"] != nil && v["duration"] != nil {
+		if duration, ok := v["duration"].(string); ok && duration != "0s" {
+			c.add(path+".duration", "Conflicts with %s.totalRequest, set only one of them", path)
+		}
+	}
+	_, hasScenarios := v["scenarios"]
+	if len(protocols) > 1 {
+		c.add(path+"."+protocols[1], "Multiple protocols %v, use scenarios to run several protocols", protocols)
+	}
+	if hasScenarios && !scenario && len(protocols) > 0 {
+		c.add(path+"."+protocols[0], "Cannot be used next to scenarios, move it into a scenario")
+	}
+	// a config without protocol can still be used with a subcommand
+	if len(protocols) == 0 && scenario {
+		c.add(path, "Missing protocol, expected one of %v", Registered())
+	}
+}
+
+// setting checks the value of a runner setting, its type is already checked.
+func (c *configValidator) setting(path string, key string, value interface{}) {
+	switch key {
+	case "concurency", "totalRequest":
+		if value.(float64) < 1 {
+			c.add(path, "Must be at least 1")
+		}
+	case "rate":
+		if value.(float64) < 0 {
+			c.add(path, "Rate cannot be negative")
+		}
+	case "precision":
+		if precision := value.(float64); precision < 1 || precision > 5 {
+			c.add(path, "Precision must be between 1 and 5")
+		}
+	case "duration", "interval", "timeout", "drainTimeout":
+		d, err := time.ParseDuration(value.(string))
+		if err != nil {
+			c.add(path, "Invalid duration %q, expected e.g. 1s, 1m, 500ms", value)
+		} else if d < 0 || (key == "interval" && d == 0) {
+			c.add(path, "Invalid duration %q, must be positive", value)
+		}
+	case "rawLogFormat":
+		if !helpers.Contains(collector.ValidRawLogFormats, value.(string)) {
+			c.add(path, "Invalid raw log format %s. Valid formats: %v", value, collector.ValidRawLogFormats)
+		}
+	case "output":
+		if _, err := report.NewWriter(value.(string)); err != nil {
+			c.add(path, "%s", err)
+		}
+	case "stageTarget":
+		if !helpers.Contains(ValidStageTargets, value.(string)) {
+			c.add(path, "Invalid stage target %s. Valid targets: %v", value, ValidStageTargets)
+		}
+	case "stageMode":
+		if !helpers.Contains(ValidStageModes, value.(string)) {
+			c.add(path, "Invalid stage mode %s. Valid modes: %v", value, ValidStageModes)
+		}
+	case "stages":
+		for i, item := range value.([]interface{}) {
+			stage, _ := item.(map[string]interface{})
+			stagePath := fmt.Sprintf("%s[%d]", path, i)
+			if duration, ok := stage["duration"].(string); !ok {
+				c.add(stagePath+".duration", "Missing required field")
+			} else if _, err := time.ParseDuration(duration); err != nil {
+				c.add(stagePath+".duration", "Invalid duration %q, expected e.g. 1s, 1m, 500ms", duration)
+			}
+			if target, ok := stage["target"].(float64); ok && target < 0 {
+				c.add(stagePath+".target", "Stage target cannot be negative")
+			}
+		}
+	}
+}
+
+func (c *configValidator) scenarios(path string, value interface{}) {
+	list, ok := value.([]interface{})
+	if !ok || len(list) == 0 {
+		c.add(path, "Expected a non-empty list of scenarios")
+		return
+	}
+	names := make(map[string]bool)
+	for i, item := range list {
+		itemPath := fmt.Sprintf("%s[%d]", path, i)
+		scenario, ok := item.(map[string]interface{})
+		if !ok {
+			c.add(itemPath, "Expected an object")
+			continue
+		}
+		if name, ok := scenario["name"].(string); !ok || name == "" {
+			c.add(itemPath+".name", "Missing required field")
+		} else if names[name] {
+			c.add(itemPath+".name", "Duplicate scenario name %s", name)
+		} else {
+			names[name] = true
+		}
+		if value, ok := scenario["startAfter"]; ok {
+			offset, isString := value.(string)
+			if d, err := time.ParseDuration(offset); !isString || err != nil || d < 0 {
+				c.add(itemPath+".startAfter", "Invalid start offset %v, expected e.g. 30s", value)
+			}
+		}
+		c.runner(itemPath, scenario, true)
+	}
+}
+
+// protocol checks a protocol block against the config struct of the
+// protocol and the checks of its definition.
+func (c *configValidator) protocol(path string, def Definition, value interface{}) {
+	block, ok := value.(map[string]interface{})
+	if !ok {
+		c.add(path, "Expected an object")
+		return
+	}
+	protocol := def.New()
+	valid := true
+	t := reflect.TypeOf(protocol)
+	if t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct {
+		valid = c.object(path, block, t.Elem())
+	}
+	if err := decodeProtocol(protocol, block); err != nil {
+		if valid {
+			c.add(path, "%s", err)
+		}
+		return
+	}
+	if def.Validate == nil {
+		return
+	}
+	for _, err := range def.Validate(protocol) {
+		c.add(path+"."+err.Path, "%s", err.Message)
+	}
+}
+
+// configField returns the field of t a JSON key decodes into. Like
+// encoding/json the key is matched case insensitively, fields without a json
+// tag are not part of the config.
+func configField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.PkgPath == "" && name != "" && name != "-" && strings.EqualFold(name, key) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func configFieldNames(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.PkgPath == "" && name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// object checks the keys of v against the struct t, it returns false if any
+// of them is unknown or of the wrong type.
+func (c *configValidator) object(path string, v map[string]interface{}, t reflect.Type) bool {
+	valid := true
+	for _, key := range sortedConfigKeys(v) {
+		keyPath := path + "." + key
+		field, ok := configField(t, key)
+		if !ok {
+			c.add(keyPath, "Unknown key, expected one of %v", configFieldNames(t))
+			valid = false
+			continue
+		}
+		if !c.value(keyPath, v[key], field.Type) {
+			valid = false
+		}
+	}
+	return valid
+}
+
+// value checks that a decoded JSON value fits the Go type t, null is
+// accepted everywhere and keeps the default.
+func (c *configValidator) value(path string, value interface{}, t reflect.Type) bool {
+	if value == nil {
+		return true
+	}
+	if t == durationType {
+		if _, ok := value.(float64); ok {
+			return true
+		}
+		c.add(path, "Expected a number of seconds, got %s", jsonType(value))
+		return false
+	}
+	var expected string
+	switch t.Kind() {
+	case reflect.Ptr:
+		return c.value(path, value, t.Elem())
+	case reflect.Interface:
+		return true
+	case reflect.String:
+		if _, ok := value.(string); ok {
+			return true
+		}
+		expected = "a string"
+	case reflect.Bool:
+		if _, ok := value.(bool); ok {
+			return true
+		}
+		expected = "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, ok := value.(float64); ok && n == math.Trunc(n) {
+			return true
+		}
+		expected = "an integer"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, ok := value.(float64); ok && n == math.Trunc(n) && n >= 0 {
+			return true
+		}
+		expected = "a positive integer"
+	case reflect.Float32, reflect.Float64:
+		if _, ok := value.(float64); ok {
+			return true
+		}
+		expected = "a number"
+	case reflect.Slice, reflect.Array:
+		if list, ok := value.([]interface{}); ok {
+			valid := true
+			for i, item := range list {
+				if !c.value(fmt.Sprintf("%s[%d]", path, i), item, t.Elem()) {
+					valid = false
+				}
+			}
+			return valid
+		}
+		expected = "a list"
+	case reflect.Map:
+		if m, ok := value.(map[string]interface{}); ok {
+			valid := true
+			for _, key := range sortedConfigKeys(m) {
+				if !c.value(path+"."+key, m[key], t.Elem()) {
+					valid = false
+				}
+			}
+			return valid
+		}
+		expected = "an object"
+	case reflect.Struct:
+		if m, ok := value.(map[string]interface{}); ok {
+			return c.object(path, m, t)
+		}
+		expected = "an object"
+	default:
+		c.add(path, "Cannot be set in a config")
+		return false
+	}
+	c.add(path, "Expected %s, got %s", expected, jsonType(value))
+	return false
+}
+
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return fmt.Sprintf("string %q", v)
+	case bool:
+		return fmt.Sprintf("boolean %v", v)
+	case float64:
+		return fmt.Sprintf("number %v", v)
+	case []interface{}:
+		return "a list"
+	case map[string]interface{}:
+		return "an object"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,104 @@
+package protocols
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		// expected "path: message" prefixes, in order
+		errs []string
+	}{
+		{"valid", `{"concurency": 2, "duration": "1s", "http": {"url": "http://127.0.0.1/"}}`, nil},
+		{"without protocol", `{"concurency": 2}`, nil},
+		{"valid scenarios", `{"duration": "1s", "scenarios": [
+			{"name": "a", "http": {"url": "http://127.0.0.1/"}},
+			{"name": "b", "startAfter": "5s", "concurency": 3, "http": {"url": "http://127.0.0.1/"}}]}`, nil},
+		{"unknown key", `{"concurrency": 2}`, []string{
+			"$.concurrency: Unknown key",
+		}},
+		{"wrong types", `{"concurency": "2", "duration": 1}`, []string{
+			"$.concurency: ",
+			"$.duration: ",
+		}},
+		{"invalid values", `{"concurency": 0, "rate": -1, "precision": 6, "interval": "0s", "timeout": "soon", "rawLogFormat": "xml"}`, []string{
+			"$.concurency: Must be at least 1",
+			"$.interval: Invalid duration \"0s\", must be positive",
+			"$.precision: Precision must be between 1 and 5",
+			"$.rate: Rate cannot be negative",
+			"$.rawLogFormat: Invalid raw log format xml",
+			"$.timeout: Invalid duration \"soon\"",
+		}},
+		{"duration and total request", `{"duration": "1s", "totalRequest": 10}`, []string{
+			"$.duration: Conflicts with $.totalRequest",
+		}},
+		{"invalid stages", `{"stages": [{"target": 10}, {"duration": "1x", "target": -1}]}`, []string{
+			"$.stages[0].duration: Missing required field",
+			"$.stages[1].duration: Invalid duration \"1x\"",
+			"$.stages[1].target: Stage target cannot be negative",
+		}},
+		{"several protocols", `{"http": {"url": "http://127.0.0.1/"}, "smtp": {"address": "127.0.0.1:25", "from": "a@b", "to": ["c@d"], "subject": "s"}}`, []string{
+			"$.smtp: Multiple protocols [http smtp]",
+		}},
+		{"invalid protocol", `{"http": {"url": "http://127.0.0.1/", "method": "FETCH", "retries": 3}}`, []string{
+			"$.http.method: Invalid HTTP methods FETCH",
+			"$.http.retries: Unknown key",
+		}},
+		{"protocol timeout", `{"http": {"url": "http://127.0.0.1/", "timeout": "1s"}}`, []string{
+			"$.http.timeout: Expected a number of seconds",
+		}},
+		{"scenario only keys", `{"name": "a", "startAfter": "1s"}`, []string{
+			"$.name: Only valid in a scenario",
+			"$.startAfter: Only valid in a scenario",
+		}},
+		{"invalid scenarios", `{"http": {"url": "http://127.0.0.1/"}, "scenarios": [
+			{"name": "a", "output": "json", "http": {"url": "http://127.0.0.1/"}},
+			{"name": "a", "startAfter": "-1s"},
+			{"http": {"url": "http://127.0.0.1/"}}]}`, []string{
+			"$.http: Cannot be used next to scenarios",
+			"$.scenarios[0].output: Cannot be set in a scenario",
+			"$.scenarios[1]: Missing protocol",
+			"$.scenarios[1].name: Duplicate scenario name a",
+			"$.scenarios[1].startAfter: Invalid start offset -1s",
+			"$.scenarios[2].name: Missing required field",
+		}},
+		{"empty scenarios", `{"scenarios": []}`, []string{
+			"$.scenarios: Expected a non-empty list of scenarios",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateConfig([]byte(tt.config))
+			if tt.errs == nil {
+				if err != nil {
+					t.Fatalf("got errors for a valid config:\n%s", err)
+				}
+				return
+			}
+			var errs ConfigErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("got %v, want ConfigErrors", err)
+			}
+			if len(errs) != len(tt.errs) {
+				t.Fatalf("got %d errors, want %d:\n%s", len(errs), len(tt.errs), errs)
+			}
+			for i, want := range tt.errs {
+				if got := errs[i].Error(); !strings.HasPrefix(got, want) {
+					t.Errorf("error %d is %q, want %q", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateConfigInvalidJson(t *testing.T) {
+	err := ValidateConfig([]byte(`{"concurency": 2`))
+	var errs ConfigErrors
+	if err == nil || errors.As(err, &errs) {
+		t.Errorf("got %v, want a JSON error", err)
+	}
+}
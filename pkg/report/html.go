@@ -0,0 +1,151 @@
+package report
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+
+	"github.com/BatikanHyt/netbench/pkg/collector"
+)
+
+//go:embed html_report.tmpl
+var htmlReport string
+
+var htmlTemplate = template.Must(template.New("report").Parse(htmlReport))
+
+// htmlWriter renders a single self-contained HTML page, every script and
+// style is inlined so the file can be shared without network access.
+type htmlWriter struct{}
+
+type htmlChartPoint struct {
+	Seconds float64 `json:"t"`
+	Rps     float64 `json:"rps"`
+	Errors  float64 `json:"errors"`
+	Mean    float64 `json:"mean"`
+	P99     float64 `json:"p99"`
+	Max     float64 `json:"max"`
+}
+
+type htmlChartBar struct {
+	Name  string  `json:"name,omitempty"`
+	From  float64 `json:"from"`
+	Count int64   `json:"count"`
+}
+
+// htmlTimeline is the series of a run, or of a scenario with its name.
+type htmlTimeline struct {
+	Name   string           `json:"name,omitempty"`
+	Points []htmlChartPoint `json:"points"`
+}
+
+type htmlChart struct {
+	Timelines []htmlTimeline `json:"timelines"`
+	Status    []htmlChartBar `json:"status"`
+	Histogram []htmlChartBar `json:"histogram"`
+}
+
+// htmlPhase is a row of the phase table, durations in milliseconds.
+type htmlPhase struct {
+	Name  string
+	Count int64
+	Mean  string
+	P50   string
+	P90   string
+	P99   string
+	Max   string
+}
+
+// htmlStep is a row of the step table, durations in milliseconds.
+type htmlStep struct {
+	Name   string
+	Count  int64
+	Failed int64
+	Mean   string
+	P50    string
+	P90    string
+	P99    string
+	Max    string
+}
+
+func (h *htmlWriter) Extension() string {
+	return "html"
+}
+
+func toMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// htmlPoints converts a timeline to chart points, offsets in seconds.
+func htmlPoints(timeline []collector.TimelinePoint) []htmlChartPoint {
+	points := []htmlChartPoint{}
+	interval := time.Second
+	if len(timeline) > 1 {
+		interval = timeline[1].Offset - timeline[0].Offset
+	}
+	for _, point := range timeline {
+		points = append(points, htmlChartPoint{
+			Seconds: point.Offset.Seconds(),
+			Rps:     float64(point.Requests) / interval.Seconds(),
+			Errors:  float64(point.Errors) / interval.Seconds(),
+			Mean:    toMs(point.MeanLatency),
+			P99:     toMs(point.P99),
+			Max:     toMs(point.MaxLatency),
+		})
+	}
+	return points
+}
+
+func (h *htmlWriter) Write(w io.Writer, result *Result) error {
+	chart := htmlChart{
+		Timelines: []htmlTimeline{},
+		Status:    []htmlChartBar{},
+		Histogram: []htmlChartBar{},
+	}
+	if len(result.Scenarios) == 0 {
+		chart.Timelines = append(chart.Timelines, htmlTimeline{Points: htmlPoints(result.Stats.Timeline)})
+	}
+	// merged statistics have no timeline, every scenario gets its own charts
+	for _, scenario := range result.Scenarios {
+		chart.Timelines = append(chart.Timelines, htmlTimeline{Name: scenario.Name, Points: htmlPoints(scenario.Stats.Timeline)})
+	}
+	for _, class := range result.StatusClasses() {
+		chart.Status = append(chart.Status, htmlChartBar{Name: class, Count: int64(result.Status[class])})
+	}
+	for _, bar := range result.Stats.Distribution {
+		chart.Histogram = append(chart.Histogram, htmlChartBar{From: toMs(bar.From), Count: bar.Count})
+	}
+	phases := []htmlPhase{}
+	for _, phase := range result.Stats.Phases {
+		l := phase.Latency
+		phases = append(phases, htmlPhase{phase.Name, phase.Count, ms(l.Mean), ms(l.P50), ms(l.P90), ms(l.P99), ms(l.Max)})
+	}
+	steps := []htmlStep{}
+	for _, step := range result.Stats.Steps {
+		l := step.Latency
+		steps = append(steps, htmlStep{step.Name, step.Count, step.Failed, ms(l.Mean), ms(l.P50), ms(l.P90), ms(l.P99), ms(l.Max)})
+	}
+	subtitle := fmt.Sprintf("%d requests in %s, generated %s", result.Stats.TotalRequest,
+		result.Stats.TotalDuration, time.Now().Format(time.RFC1123))
+	if result.Interrupted {
+		subtitle += ", interrupted with partial results"
+	}
+	return htmlTemplate.Execute(w, struct {
+		Protocol string
+		Subtitle string
+		Metrics  []metric
+		Phases   []htmlPhase
+		Steps    []htmlStep
+		Errors   []collector.ErrorSummary
+		Chart    htmlChart
+	}{
+		Protocol: result.Protocol,
+		Subtitle: subtitle,
+		Metrics:  result.metrics(),
+		Phases:   phases,
+		Steps:    steps,
+		Errors:   result.Stats.Errors,
+		Chart:    chart,
+	})
+}
@@ -0,0 +1,167 @@
+package report
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BatikanHyt/netbench/pkg/collector"
+)
+
+// Result is the outcome of a benchmark run as handed to the writers.
+type Result struct {
+	Name           string                    `json:"name,omitempty"` // scenario name
+	Protocol       string                    `json:"protocol"`
+	Concurency     int                       `json:"concurency"`
+	TotalRequest   int                       `json:"totalRequest"`
+	Duration       string                    `json:"duration"`
+	Rate           float64                   `json:"rate"`
+	Dropped        int64                     `json:"dropped"`
+	Interrupted    bool                      `json:"interrupted"` // the results are partial
+	RequestsPerSec float64                   `json:"requestsPerSec"`
+	Stats          collector.GlobalStatistic `json:"stats"`
+	// HTTP status classes or SMTP reply classes and their counts
+	Status map[string]int `json:"status"`
+	// results of the scenarios of a mixed run, Stats combines them
+	Scenarios []*Result `json:"scenarios,omitempty"`
+}
+
+// StatusClasses returns the status classes of the result in sorted order.
+func (r *Result) StatusClasses() []string {
+	classes := make([]string, 0, len(r.Status))
+	for class := range r.Status {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	return classes
+}
+
+// metric is a single named value of a result, used by the tabular writers.
+type metric struct {
+	Name  string
+	Value string
+}
+
+func ms(d time.Duration) string {
+	return fmt.Sprintf("%.3f", float64(d)/float64(time.Millisecond))
+}
+
+// metrics flattens the result into name/value pairs, durations are given in
+// milliseconds.
+func (r *Result) metrics() []metric {
+	s := r.Stats
+	m := []metric{
+		{"protocol", r.Protocol},
+		{"concurency", fmt.Sprint(r.Concurency)},
+		{"total_request", fmt.Sprint(s.TotalRequest)},
+		{"successful_request", fmt.Sprint(s.SuccessfulReq)},
+		{"failed_request", fmt.Sprint(s.FailedReq)},
+		{"cancelled_request", fmt.Sprint(s.Cancelled)},
+		{"dropped", fmt.Sprint(r.Dropped)},
+		{"interrupted", fmt.Sprint(r.Interrupted)},
+		{"rate", fmt.Sprint(r.Rate)},
+		{"total_duration_ms", ms(s.TotalDuration)},
+		{"requests_per_sec", fmt.Sprintf("%.3f", r.RequestsPerSec)},
+		{"throughput_mb_per_sec", fmt.Sprintf("%.6f", s.Throughput)},
+		{"total_size_bytes", fmt.Sprint(s.TotalSize)},
+		{"read_bytes", fmt.Sprint(s.ReadSize)},
+		{"write_bytes", fmt.Sprint(s.WriteSize)},
+		{"body_read_bytes", fmt.Sprint(s.BodyReadSize)},
+		{"body_write_bytes", fmt.Sprint(s.BodyWriteSize)},
+	}
+	for _, l := range []struct {
+		prefix  string
+		summary collector.LatencySummary
+	}{{"service_time", s.ServiceTime}, {"response_time", s.ResponseTime}} {
+		m = append(m,
+			metric{l.prefix + "_min_ms", ms(l.summary.Min)},
+			metric{l.prefix + "_mean_ms", ms(l.summary.Mean)},
+			metric{l.prefix + "_stddev_ms", ms(l.summary.StdDev)},
+			metric{l.prefix + "_max_ms", ms(l.summary.Max)})
+		for _, p := range collector.SummaryPercentiles {
+			value, _ := l.summary.Percentile(p)
+			name := strings.Replace(fmt.Sprintf("%s_p%v_ms", l.prefix, p), ".", "_", 1)
+			m = append(m, metric{name, ms(value)})
+		}
+	}
+	for _, phase := range s.Phases {
+		prefix := "phase_" + phase.Name
+		m = append(m,
+			metric{prefix + "_count", fmt.Sprint(phase.Count)},
+			metric{prefix + "_mean_ms", ms(phase.Latency.Mean)},
+			metric{prefix + "_p50_ms", ms(phase.Latency.P50)},
+			metric{prefix + "_p90_ms", ms(phase.Latency.P90)},
+			metric{prefix + "_p99_ms", ms(phase.Latency.P99)},
+			metric{prefix + "_max_ms", ms(phase.Latency.Max)})
+	}
+	for _, step := range s.Steps {
+		prefix := "step_" + step.Name
+		m = append(m,
+			metric{prefix + "_count", fmt.Sprint(step.Count)},
+			metric{prefix + "_failed", fmt.Sprint(step.Failed)},
+			metric{prefix + "_mean_ms", ms(step.Latency.Mean)},
+			metric{prefix + "_p50_ms", ms(step.Latency.P50)},
+			metric{prefix + "_p90_ms", ms(step.Latency.P90)},
+			metric{prefix + "_p99_ms", ms(step.Latency.P99)},
+			metric{prefix + "_max_ms", ms(step.Latency.Max)})
+	}
+	for _, key := range sortedKeys(s.Labels) {
+		for _, value := range sortedValues(s.Labels[key]) {
+			m = append(m, metric{key + "_" + value, fmt.Sprint(s.Labels[key][value])})
+		}
+	}
+	for _, class := range r.StatusClasses() {
+		m = append(m, metric{"status_" + class, fmt.Sprint(r.Status[class])})
+	}
+	for _, e := range s.Errors {
+		m = append(m, metric{"error_" + e.Kind + "_" + e.Phase, fmt.Sprint(e.Count)})
+	}
+	for _, scenario := range r.Scenarios {
+		for _, sm := range scenario.metrics() {
+			m = append(m, metric{"scenario_" + scenario.Name + "_" + sm.Name, sm.Value})
+		}
+	}
+	return m
+}
+
+func sortedKeys(m map[string]map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedValues(m map[string]int) []string {
+	values := make([]string, 0, len(m))
+	for value := range m {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return values
+}
+
+// WriteFile serializes the result with the writer of the given format. An
+// empty path writes to netbench-result with the extension of the format.
+func WriteFile(format string, path string, result *Result) error {
+	writer, err := NewWriter(format)
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		path = "netbench-result." + writer.Extension()
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := writer.Write(file, result); err != nil {
+		return err
+	}
+	fmt.Printf("Results written to %s\n", path)
+	return nil
+}
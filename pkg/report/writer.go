@@ -0,0 +1,210 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/BatikanHyt/netbench/pkg/collector"
+)
+
+// Writer serializes a result into one output format.
+type Writer interface {
+	Write(w io.Writer, result *Result) error
+	Extension() string
+}
+
+var writerMap = map[string]func() Writer{
+	"json":     func() Writer { return &jsonWriter{} },
+	"csv":      func() Writer { return &csvWriter{} },
+	"markdown": func() Writer { return &markdownWriter{} },
+	"html":     func() Writer { return &htmlWriter{} },
+	"timeline": func() Writer { return &timelineWriter{} },
+}
+
+// RegisterWriter makes an output format selectable by name.
+func RegisterWriter(format string, create func() Writer) {
+	writerMap[format] = create
+}
+
+func NewWriter(format string) (Writer, error) {
+	create, ok := writerMap[format]
+	if !ok {
+		return nil, fmt.Errorf("Invalid output format %s. Valid formats: %v", format, Formats())
+	}
+	return create(), nil
+}
+
+// Formats returns the names of the registered output formats.
+func Formats() []string {
+	formats := make([]string, 0, len(writerMap))
+	for format := range writerMap {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+type jsonWriter struct{}
+
+func (j *jsonWriter) Extension() string {
+	return "json"
+}
+
+func (j *jsonWriter) Write(w io.Writer, result *Result) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
+
+type csvWriter struct{}
+
+func (c *csvWriter) Extension() string {
+	return "csv"
+}
+
+func (c *csvWriter) Write(w io.Writer, result *Result) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"metric", "value"})
+	for _, m := range result.metrics() {
+		writer.Write([]string{m.Name, m.Value})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// timelineWriter exports the per-interval series as CSV.
+type timelineWriter struct{}
+
+func (t *timelineWriter) Extension() string {
+	return "timeline.csv"
+}
+
+func (t *timelineWriter) Write(w io.Writer, result *Result) error {
+	writer := csv.NewWriter(w)
+	header := []string{"offset_sec", "requests", "errors", "bytes", "mean_ms", "p50_ms", "p90_ms", "p99_ms", "max_ms"}
+	if len(result.Scenarios) == 0 {
+		writer.Write(header)
+		writeTimeline(writer, "", result.Stats.Timeline)
+	} else {
+		// timelines are kept per scenario, offsets are from its start
+		writer.Write(append([]string{"scenario"}, header...))
+		for _, scenario := range result.Scenarios {
+			writeTimeline(writer, scenario.Name, scenario.Stats.Timeline)
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeTimeline writes a row per point, led by the scenario name if any.
+func writeTimeline(writer *csv.Writer, scenario string, timeline []collector.TimelinePoint) {
+	for _, point := range timeline {
+		row := []string{
+			fmt.Sprint(point.Offset.Seconds()),
+			fmt.Sprint(point.Requests),
+			fmt.Sprint(point.Errors),
+			fmt.Sprint(point.Bytes),
+			ms(point.MeanLatency),
+			ms(point.P50),
+			ms(point.P90),
+			ms(point.P99),
+			ms(point.MaxLatency),
+		}
+		if scenario != "" {
+			row = append([]string{scenario}, row...)
+		}
+		writer.Write(row)
+	}
+}
+
+type markdownWriter struct{}
+
+func (m *markdownWriter) Extension() string {
+	return "md"
+}
+
+func (m *markdownWriter) Write(w io.Writer, result *Result) error {
+	s := result.Stats
+	fmt.Fprintf(w, "# netbench %s result\n\n", result.Protocol)
+	if result.Interrupted {
+		fmt.Fprintf(w, "**The run was interrupted, the results are partial.**\n\n")
+	}
+	fmt.Fprintf(w, "| Metric | Value |\n|---|---|\n")
+	fmt.Fprintf(w, "| Concurency | %d |\n", result.Concurency)
+	fmt.Fprintf(w, "| Total requests | %d |\n", s.TotalRequest)
+	fmt.Fprintf(w, "| Successful requests | %d |\n", s.SuccessfulReq)
+	fmt.Fprintf(w, "| Failed requests | %d |\n", s.FailedReq)
+	fmt.Fprintf(w, "| Cancelled requests | %d |\n", s.Cancelled)
+	if result.Rate > 0 || result.Dropped > 0 {
+		fmt.Fprintf(w, "| Target rate | %.2f req/s |\n", result.Rate)
+		fmt.Fprintf(w, "| Dropped arrivals | %d |\n", result.Dropped)
+	}
+	fmt.Fprintf(w, "| Total duration | %s |\n", s.TotalDuration)
+	fmt.Fprintf(w, "| Requests/sec | %.2f |\n", result.RequestsPerSec)
+	fmt.Fprintf(w, "| Throughput | %.6f MB/s |\n", s.Throughput)
+	fmt.Fprintf(w, "| Total recv/send bytes | %d |\n", s.TotalSize)
+	fmt.Fprintf(w, "| Wire recv/send bytes | %d/%d |\n", s.ReadSize, s.WriteSize)
+	fmt.Fprintf(w, "| Body recv/send bytes | %d/%d |\n", s.BodyReadSize, s.BodyWriteSize)
+
+	fmt.Fprintf(w, "\n## Latency\n\n")
+	fmt.Fprintf(w, "| | Min | Mean | StdDev | p50 | p75 | p90 | p95 | p99 | p99.9 | p99.99 | Max |\n")
+	fmt.Fprintf(w, "|---|---|---|---|---|---|---|---|---|---|---|---|\n")
+	for _, l := range []struct {
+		name string
+		s    collector.LatencySummary
+	}{{"Service time", s.ServiceTime}, {"Response time", s.ResponseTime}} {
+		fmt.Fprintf(w, "| %s | %s | %s | %s | %s | %s | %s | %s | %s | %s | %s | %s |\n", l.name,
+			l.s.Min, l.s.Mean, l.s.StdDev, l.s.P50, l.s.P75, l.s.P90, l.s.P95, l.s.P99, l.s.P999, l.s.P9999, l.s.Max)
+	}
+
+	if len(s.Phases) > 0 {
+		fmt.Fprintf(w, "\n## Phases\n\n| Phase | Count | Mean | p50 | p90 | p99 | Max |\n|---|---|---|---|---|---|---|\n")
+	}
+	for _, phase := range s.Phases {
+		l := phase.Latency
+		fmt.Fprintf(w, "| %s | %d | %s | %s | %s | %s | %s |\n", phase.Name, phase.Count, l.Mean, l.P50, l.P90, l.P99, l.Max)
+	}
+	if len(s.Steps) > 0 {
+		fmt.Fprintf(w, "\n## Steps\n\n| Step | Count | Failed | Mean | p50 | p90 | p99 | Max |\n|---|---|---|---|---|---|---|---|\n")
+	}
+	for _, step := range s.Steps {
+		l := step.Latency
+		fmt.Fprintf(w, "| %s | %d | %d | %s | %s | %s | %s | %s |\n", step.Name, step.Count, step.Failed, l.Mean, l.P50, l.P90, l.P99, l.Max)
+	}
+	for _, key := range sortedKeys(s.Labels) {
+		fmt.Fprintf(w, "\n## %s\n\n| Value | Count |\n|---|---|\n", key)
+		for _, value := range sortedValues(s.Labels[key]) {
+			fmt.Fprintf(w, "| %s | %d |\n", value, s.Labels[key][value])
+		}
+	}
+
+	fmt.Fprintf(w, "\n## Status\n\n| Class | Count |\n|---|---|\n")
+	for _, class := range result.StatusClasses() {
+		fmt.Fprintf(w, "| %s | %d |\n", class, result.Status[class])
+	}
+
+	if len(result.Scenarios) > 0 {
+		fmt.Fprintf(w, "\n## Scenarios\n\n| Scenario | Protocol | Requests | Failed | Requests/sec | p50 | p99 | Max |\n|---|---|---|---|---|---|---|---|\n")
+	}
+	for _, scenario := range result.Scenarios {
+		l := scenario.Stats.ResponseTime
+		fmt.Fprintf(w, "| %s | %s | %d | %d | %.2f | %s | %s | %s |\n", scenario.Name, scenario.Protocol,
+			scenario.Stats.TotalRequest, scenario.Stats.FailedReq, scenario.RequestsPerSec, l.P50, l.P99, l.Max)
+	}
+
+	if len(s.Errors) > 0 {
+		fmt.Fprintf(w, "\n## Errors\n\n| Kind | Phase | Count | Sample messages |\n|---|---|---|---|\n")
+	}
+	for _, e := range s.Errors {
+		samples := make([]string, 0, len(e.Samples))
+		for _, sample := range e.Samples {
+			samples = append(samples, fmt.Sprintf("(%d) %s", sample.Count, strings.ReplaceAll(sample.Message, "|", "\\|")))
+		}
+		fmt.Fprintf(w, "| %s | %s | %d | %s |\n", e.Kind, e.Phase, e.Count, strings.Join(samples, "<br>"))
+	}
+	return nil
+}